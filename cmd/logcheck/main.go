@@ -0,0 +1,54 @@
+// Command logcheck validates logging configuration files, so that mistakes are
+// caught in CI instead of at service start:
+//
+//	logcheck conf/log.ini conf/log_prod.ini
+//
+// Every problem is printed as `file:line: [section] key: message`, and the exit
+// status is 1 if any file has an error, or a warning with `-strict`.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kisunSea/gopkg/logging"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s conf.ini [conf.ini ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	strict := flag.Bool("strict", false, "fail on warnings too")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, conf := range flag.Args() {
+		err := logging.ValidateConf(conf)
+		if err == nil {
+			continue
+		}
+
+		var problems logging.ConfErrors
+		if !errors.As(err, &problems) {
+			failed = true
+			fmt.Fprintf(os.Stderr, "%s: %v\n", conf, err)
+			continue
+		}
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, p)
+		}
+		if *strict || problems.HasErrors() {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
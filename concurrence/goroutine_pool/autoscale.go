@@ -0,0 +1,228 @@
+package goroutine_pool
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kisunSea/gopkg/logging"
+)
+
+const (
+	defaultAutoscaleInterval  = time.Second
+	defaultAutoscaleQueueWait = 10 * time.Millisecond
+	// a throughput change smaller than this fraction is noise
+	autoscaleTolerance = 0.05
+)
+
+// autoscaling ...
+//
+// The autoscaler samples the pool every `Interval` and moves the capacity by
+// `Step` between `MinCap` and `MaxCap`, hill-climbing on the throughput:
+//
+//   - the tasks wait in the queue longer than `TargetQueueWait`: it scales up,
+//     unless the previous scale-up brought no throughput, and then it holds
+//   - a scale-up made the tasks slower without bringing throughput, e.g. a
+//     saturated downstream: it scales back down
+//   - the queue is empty and the workers are not all busy: it scales down
+//
+// Every change of capacity is an `AutoscaleEvent`, passed to `OnDecision`,
+// logged and counted in `Stats`.
+
+// AutoscaleConfig enables the autoscaler of a pool, see `Config.Autoscale`.
+type AutoscaleConfig struct {
+	// MinCap and MaxCap bound the capacity, MaxCap is the capacity given to
+	// `NewPool` if it is 0
+	MinCap int32
+	MaxCap int32
+	// Interval between two decisions, 1s by default
+	Interval time.Duration
+	// Step is the change of capacity of a decision, 1 by default
+	Step int32
+	// TargetQueueWait is the mean queue wait above which the pool scales up, 10ms by default
+	TargetQueueWait time.Duration
+	// OnDecision is called with every change of capacity
+	OnDecision func(AutoscaleEvent)
+}
+
+// AutoscaleEvent describes a decision of the autoscaler and the sample it is based on.
+type AutoscaleEvent struct {
+	Time   time.Time
+	OldCap int32
+	NewCap int32
+	Reason string
+	// Throughput is the number of tasks completed per second during the sample
+	Throughput float64
+	// QueueWait and RunTime are the means of the sample
+	QueueWait time.Duration
+	RunTime   time.Duration
+	Queued    int32
+	Running   int32
+}
+
+const (
+	reasonQueueWait = "queue wait above target"
+	reasonSlower    = "tasks slower without throughput gain"
+	reasonIdle      = "idle capacity"
+)
+
+// autoscaleSample is the activity of the pool during an interval.
+type autoscaleSample struct {
+	throughput float64
+	queueWait  time.Duration
+	runTime    time.Duration
+	queued     int32
+	running    int32
+}
+
+type autoscaler struct {
+	pool   *pool
+	config AutoscaleConfig
+	stop   chan struct{}
+	once   sync.Once
+
+	// the previous sample and decision, for the hill climbing
+	last     autoscaleSample
+	lastMove int32
+	// cumulative counters at the previous sample
+	completed uint64
+	waitCount uint64
+	waitSum   time.Duration
+	runCount  uint64
+	runSum    time.Duration
+	at        time.Time
+}
+
+func newAutoscaler(p *pool, config AutoscaleConfig) *autoscaler {
+	if config.MaxCap <= 0 {
+		config.MaxCap = p.Capacity()
+	}
+	if config.MinCap <= 0 {
+		config.MinCap = 1
+	}
+	if config.MinCap > config.MaxCap {
+		config.MinCap = config.MaxCap
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultAutoscaleInterval
+	}
+	if config.Step <= 0 {
+		config.Step = 1
+	}
+	if config.TargetQueueWait <= 0 {
+		config.TargetQueueWait = defaultAutoscaleQueueWait
+	}
+	return &autoscaler{pool: p, config: config, stop: make(chan struct{}), at: time.Now()}
+}
+
+func (a *autoscaler) run() {
+	ticker := time.NewTicker(a.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			a.step(now)
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+func (a *autoscaler) close() {
+	a.once.Do(func() { close(a.stop) })
+}
+
+// sample returns the activity of the pool since the previous sample.
+func (a *autoscaler) sample(now time.Time) autoscaleSample {
+	st := &a.pool.stats
+	completed := atomic.LoadUint64(&st.completed)
+	waitCount, waitSum := atomic.LoadUint64(&st.queueWait.count), time.Duration(atomic.LoadInt64(&st.queueWait.sum))
+	runCount, runSum := atomic.LoadUint64(&st.runTime.count), time.Duration(atomic.LoadInt64(&st.runTime.sum))
+
+	s := autoscaleSample{
+		queued:  a.pool.taskCount_(),
+		running: atomic.LoadInt32(&st.running),
+	}
+	if elapsed := now.Sub(a.at).Seconds(); elapsed > 0 {
+		s.throughput = float64(completed-a.completed) / elapsed
+	}
+	if n := waitCount - a.waitCount; n > 0 {
+		s.queueWait = (waitSum - a.waitSum) / time.Duration(n)
+	}
+	if n := runCount - a.runCount; n > 0 {
+		s.runTime = (runSum - a.runSum) / time.Duration(n)
+	}
+	if s.queued > 0 {
+		// the tasks still queued have waited since the last pop at least,
+		// take the oldest of them into account
+		if wait := a.pool.oldestQueueWait(now); wait > s.queueWait {
+			s.queueWait = wait
+		}
+	}
+
+	a.completed, a.waitCount, a.waitSum, a.runCount, a.runSum, a.at =
+		completed, waitCount, waitSum, runCount, runSum, now
+	return s
+}
+
+// decide returns the move of the capacity for sample `s`, and its reason.
+func (a *autoscaler) decide(cap int32, s autoscaleSample) (move int32, reason string) {
+	gained := s.throughput > a.last.throughput*(1+autoscaleTolerance)
+	switch {
+	case a.lastMove > 0 && !gained && a.last.runTime > 0 &&
+		float64(s.runTime) > float64(a.last.runTime)*(1+autoscaleTolerance):
+		move, reason = -a.config.Step, reasonSlower
+	case s.queueWait > a.config.TargetQueueWait && s.queued > 0:
+		if a.lastMove > 0 && !gained {
+			// the previous step up did not help, hold
+			break
+		}
+		move, reason = a.config.Step, reasonQueueWait
+	case s.queued == 0 && s.running < cap && s.queueWait < a.config.TargetQueueWait/2:
+		move, reason = -a.config.Step, reasonIdle
+	}
+
+	if next := cap + move; next > a.config.MaxCap {
+		move = a.config.MaxCap - cap
+	} else if next < a.config.MinCap {
+		move = a.config.MinCap - cap
+	}
+	return move, reason
+}
+
+func (a *autoscaler) step(now time.Time) {
+	s := a.sample(now)
+	cap := a.pool.Capacity()
+	move, reason := a.decide(cap, s)
+	a.last, a.lastMove = s, move
+	if move == 0 {
+		return
+	}
+
+	a.pool.SetCap(cap + move)
+	if move > 0 {
+		atomic.AddUint64(&a.pool.stats.scaleUps, 1)
+	} else {
+		atomic.AddUint64(&a.pool.stats.scaleDowns, 1)
+	}
+	event := AutoscaleEvent{
+		Time:       now,
+		OldCap:     cap,
+		NewCap:     cap + move,
+		Reason:     reason,
+		Throughput: s.throughput,
+		QueueWait:  s.queueWait,
+		RunTime:    s.runTime,
+		Queued:     s.queued,
+		Running:    s.running,
+	}
+	a.pool.lastScale.Store(event)
+	logger.InfoT("GOPOOL: capacity scaled", logging.String("pool", a.pool.name),
+		logging.Int("old_cap", int(event.OldCap)), logging.Int("new_cap", int(event.NewCap)),
+		logging.String("reason", reason), logging.Float64("throughput", s.throughput),
+		logging.Duration("queue_wait", s.queueWait), logging.Duration("run_time", s.runTime),
+		logging.Int("queued", int(s.queued)))
+	if a.config.OnDecision != nil {
+		a.config.OnDecision(event)
+	}
+}
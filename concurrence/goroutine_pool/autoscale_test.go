@@ -0,0 +1,141 @@
+package goroutine_pool
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAutoscaleDecide(t *testing.T) {
+	p := NewPool("autoscale", 4, NewDefaultConfig()).(*pool)
+	a := newAutoscaler(p, AutoscaleConfig{MinCap: 2, MaxCap: 8, Step: 2, TargetQueueWait: 10 * time.Millisecond})
+
+	for _, tc := range []struct {
+		name     string
+		last     autoscaleSample
+		lastMove int32
+		cap      int32
+		sample   autoscaleSample
+		move     int32
+		reason   string
+	}{
+		{
+			name:   "queue wait above target",
+			cap:    4,
+			sample: autoscaleSample{throughput: 100, queueWait: 50 * time.Millisecond, queued: 10, running: 4},
+			move:   2, reason: reasonQueueWait,
+		},
+		{
+			name:     "the step up brought throughput",
+			last:     autoscaleSample{throughput: 100, runTime: time.Millisecond},
+			lastMove: 2,
+			cap:      6,
+			sample:   autoscaleSample{throughput: 150, queueWait: 50 * time.Millisecond, runTime: time.Millisecond, queued: 10, running: 6},
+			move:     2, reason: reasonQueueWait,
+		},
+		{
+			name:     "the step up brought nothing",
+			last:     autoscaleSample{throughput: 100, runTime: time.Millisecond},
+			lastMove: 2,
+			cap:      6,
+			sample:   autoscaleSample{throughput: 101, queueWait: 50 * time.Millisecond, runTime: time.Millisecond, queued: 10, running: 6},
+		},
+		{
+			name:     "the step up made the tasks slower",
+			last:     autoscaleSample{throughput: 100, runTime: time.Millisecond},
+			lastMove: 2,
+			cap:      6,
+			sample:   autoscaleSample{throughput: 100, queueWait: 50 * time.Millisecond, runTime: 2 * time.Millisecond, queued: 10, running: 6},
+			move:     -2, reason: reasonSlower,
+		},
+		{
+			name:   "idle",
+			cap:    6,
+			sample: autoscaleSample{throughput: 10, running: 1},
+			move:   -2, reason: reasonIdle,
+		},
+		{
+			name:   "bounded by MaxCap",
+			cap:    7,
+			sample: autoscaleSample{queueWait: time.Second, queued: 10, running: 7},
+			move:   1, reason: reasonQueueWait,
+		},
+		{
+			name:   "bounded by MinCap",
+			cap:    2,
+			sample: autoscaleSample{},
+			move:   0, reason: reasonIdle,
+		},
+		{
+			name:   "busy without queue",
+			cap:    4,
+			sample: autoscaleSample{throughput: 100, running: 4},
+		},
+	} {
+		a.last, a.lastMove = tc.last, tc.lastMove
+		move, reason := a.decide(tc.cap, tc.sample)
+		if move != tc.move || (move != 0 && reason != tc.reason) {
+			t.Errorf("%s: expected %d (%s), got %d (%s)", tc.name, tc.move, tc.reason, move, reason)
+		}
+	}
+}
+
+func TestAutoscale(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []AutoscaleEvent
+	)
+	config := NewDefaultConfig()
+	config.ScaleThreshold = 1
+	config.Autoscale = &AutoscaleConfig{
+		MinCap:          1,
+		MaxCap:          8,
+		Interval:        20 * time.Millisecond,
+		TargetQueueWait: time.Millisecond,
+		OnDecision: func(event AutoscaleEvent) {
+			mu.Lock()
+			events = append(events, event)
+			mu.Unlock()
+		},
+	}
+	p := NewPool("autoscale", 2, config)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 400; i++ {
+		wg.Add(1)
+		p.Go(func() {
+			time.Sleep(2 * time.Millisecond)
+			wg.Done()
+		})
+	}
+	wg.Wait()
+	s := p.Stats()
+	if s.ScaleUps == 0 || s.LastScale == nil {
+		t.Fatalf("no scale up under load: %+v", s)
+	}
+
+	// the idle pool shrinks back to MinCap
+	deadline := time.Now().Add(2 * time.Second)
+	for p.Stats().Capacity > 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// let the last decision complete, there is none at MinCap
+	time.Sleep(50 * time.Millisecond)
+	if s = p.Stats(); s.Capacity != 1 || s.ScaleDowns == 0 || s.LastScale.Reason != reasonIdle {
+		t.Errorf("idle pool not scaled down: %+v", s)
+	}
+
+	mu.Lock()
+	if uint64(len(events)) != s.ScaleUps+s.ScaleDowns {
+		t.Errorf("%d events for %d decisions", len(events), s.ScaleUps+s.ScaleDowns)
+	}
+	if e := events[0]; e.NewCap <= e.OldCap || e.Reason != reasonQueueWait || e.QueueWait < time.Millisecond {
+		t.Errorf("unexpected first event %+v", e)
+	}
+	mu.Unlock()
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,12 +1,56 @@
 package goroutine_pool
 
+import "time"
+
 const defaultScalaThreshold = 1
 
+// QueueFullPolicy decides what happens to a task submitted when the task list
+// holds `Config.MaxQueueLen` tasks. It does not apply to the scheduled tasks
+// and the retries, which are skipped or rescheduled, see `GoAfter`.
+type QueueFullPolicy int
+
+const (
+	// PolicyBlock blocks the caller until a task leaves the list
+	PolicyBlock QueueFullPolicy = iota
+	// PolicyBlockCtx blocks the caller until a task leaves the list or the
+	// context of the task is done, the task is then rejected with `ctx.Err()`
+	PolicyBlockCtx
+	// PolicyReject rejects the task with `ErrPoolFull`
+	PolicyReject
+	// PolicyCallerRuns runs the task in the goroutine of the caller
+	PolicyCallerRuns
+	// PolicyDiscardOldest discards the oldest queued task to make room
+	PolicyDiscardOldest
+)
+
 type Config struct {
 	// 当等待的任务数大于ScaleThreshold时，就启动新的goroutine
 	ScaleThreshold int32
+	// MaxQueueLen 是任务列表的最大长度, 0表示不限制
+	MaxQueueLen int32
+	// QueueFullPolicy 任务列表满时的处理策略
+	QueueFullPolicy QueueFullPolicy
+	// AgingInterval 任务每等待一个AgingInterval就提升一个优先级, 避免低优先级任务饿死, 0表示不提升
+	AgingInterval time.Duration
+	// TaskTimeout 是`CtxGoErr`任务的默认超时时间, 0表示不超时, 见`WithTaskTimeout`
+	TaskTimeout time.Duration
+	// MinWorkers 个常驻的worker在NewPool时启动, 没有任务时挂起等待而不退出
+	MinWorkers int32
+	// IdleTimeout 是其余worker没有任务时挂起等待的时间, 0表示立即退出
+	IdleTimeout time.Duration
+	// RateLimit 是每秒最多启动的任务数, 0表示不限制, 见`Pool.SetRateLimit`
+	RateLimit float64
+	// RateBurst 是可以连续启动的任务数, 最小为1
+	RateBurst int32
+	// RetryPolicy 是`CtxGoErr`任务的默认重试策略, nil表示不重试, 见`WithRetryPolicy`
+	RetryPolicy *RetryPolicy
+	// Autoscale 启用容量的自动调整, nil表示容量固定, 见`AutoscaleConfig`
+	Autoscale *AutoscaleConfig
+	// Shards 是任务队列的分片数, 取不大于它的2的幂, 0或1表示不分片, 负数表示按GOMAXPROCS和容量选择.
+	// 分片后优先级、老化和`PolicyDiscardOldest`只在分片内有效, 不分片时所有任务严格按优先级出队
+	Shards int32
 }
 
 func NewDefaultConfig() *Config {
-	return &Config{ScaleThreshold: defaultScalaThreshold}
+	return &Config{ScaleThreshold: defaultScalaThreshold, AgingInterval: defaultAgingInterval}
 }
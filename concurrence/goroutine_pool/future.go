@@ -0,0 +1,196 @@
+package goroutine_pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/kisunSea/gopkg/runtime/traceback"
+)
+
+// ErrCancelled is the error of a future cancelled before its task started.
+var ErrCancelled = errors.New("task cancelled")
+
+// Callable is a task that returns a result, see `Pool.Submit`.
+type Callable func() (interface{}, error)
+
+// PanicError is the error of a future whose task panicked.
+type PanicError struct {
+	Value interface{}
+	Stack string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panicked: %v\n%s", e.Value, e.Stack)
+}
+
+const (
+	futurePending int32 = iota
+	futureRunning
+	futureDone
+)
+
+// Future is the pending result of a task submitted by `Pool.Submit`.
+type Future struct {
+	state  int32
+	done   chan struct{}
+	notify chan<- *Future // receives the future once done, see `withFutureNotify`
+	result interface{}
+	err    error
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+type futureNotifyCtxKey struct{}
+
+// withFutureNotify returns a copy of `ctx` whose futures are sent to `notify`
+// once done, `notify` must have room for every one of them.
+func withFutureNotify(ctx context.Context, notify chan<- *Future) context.Context {
+	return context.WithValue(ctx, futureNotifyCtxKey{}, notify)
+}
+
+// finish closes `done` and notifies the waiter set at submission, if any.
+func (f *Future) finish() {
+	close(f.done)
+	if f.notify != nil {
+		f.notify <- f
+	}
+}
+
+// Get waits for the task and returns its result, or `ctx.Err()` if ctx is
+// done first.
+func (f *Future) Get(ctx context.Context) (interface{}, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Done returns a channel that is closed when the result is available.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Cancel cancels the task if it has not started yet, its result is then
+// `ErrCancelled`. It returns false if the task is running or done.
+func (f *Future) Cancel() bool {
+	if !atomic.CompareAndSwapInt32(&f.state, futurePending, futureDone) {
+		return false
+	}
+	f.err = ErrCancelled
+	f.finish()
+	return true
+}
+
+func (f *Future) complete(result interface{}, err error) {
+	f.result, f.err = result, err
+	atomic.StoreInt32(&f.state, futureDone)
+	f.finish()
+}
+
+// fail completes a future whose task did not run.
+func (f *Future) fail(err error) {
+	if atomic.CompareAndSwapInt32(&f.state, futurePending, futureRunning) {
+		f.complete(nil, err)
+	}
+}
+
+// run is the task given to the pool, it turns a panic of `call` into a `*PanicError`.
+func (f *Future) run(call Callable) {
+	if !atomic.CompareAndSwapInt32(&f.state, futurePending, futureRunning) {
+		return
+	}
+
+	var (
+		result interface{}
+		err    error
+	)
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: traceback.TakeStacktrace(1)}
+		}
+		f.complete(result, err)
+	}()
+	result, err = call()
+}
+
+func (p *pool) Submit(call Callable) *Future {
+	return p.CtxSubmit(context.Background(), call)
+}
+
+func (p *pool) CtxSubmit(ctx context.Context, call Callable) *Future {
+	f := newFuture()
+	if ctx != nil {
+		f.notify, _ = ctx.Value(futureNotifyCtxKey{}).(chan<- *Future)
+	}
+	t := newPoolTask(ctx)
+	t.f = func() { f.run(call) }
+	t.onCancel = f.fail
+	if err := p.trySubmit(t); err != nil {
+		f.fail(err)
+	}
+	return f
+}
+
+// InvokeAll submits `tasks` to `p` and waits for all of them. The futures are
+// in the order of `tasks`. If ctx is done first, the tasks that have not
+// started are cancelled and `ctx.Err()` is returned with the futures.
+func InvokeAll(ctx context.Context, p Pool, tasks []Callable) ([]*Future, error) {
+	futures := make([]*Future, 0, len(tasks))
+	for _, task := range tasks {
+		futures = append(futures, p.CtxSubmit(ctx, task))
+	}
+	for _, f := range futures {
+		select {
+		case <-f.Done():
+		case <-ctx.Done():
+			for _, f := range futures {
+				f.Cancel()
+			}
+			return futures, ctx.Err()
+		}
+	}
+	return futures, nil
+}
+
+// InvokeAny submits `tasks` to `p` and returns the result of the first one
+// that succeeds, the tasks that have not started are then cancelled. If all
+// of them fail, the error of the last one to fail is returned.
+func InvokeAny(ctx context.Context, p Pool, tasks []Callable) (interface{}, error) {
+	if len(tasks) == 0 {
+		return nil, errors.New("no task to invoke")
+	}
+
+	var (
+		done    = make(chan *Future, len(tasks))
+		futures = make([]*Future, 0, len(tasks))
+	)
+	defer func() {
+		for _, f := range futures {
+			f.Cancel()
+		}
+	}()
+	submitCtx := withFutureNotify(ctx, done)
+	for _, task := range tasks {
+		futures = append(futures, p.CtxSubmit(submitCtx, task))
+	}
+
+	var lastErr error
+	for range tasks {
+		select {
+		case f := <-done:
+			if f.err == nil {
+				return f.result, nil
+			}
+			lastErr = f.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return nil, lastErr
+}
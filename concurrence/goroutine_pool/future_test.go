@@ -0,0 +1,132 @@
+package goroutine_pool
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubmit(t *testing.T) {
+	p := NewPool("future", 2, NewDefaultConfig())
+
+	f := p.Submit(func() (interface{}, error) { return 42, nil })
+	if v, err := f.Get(context.Background()); err != nil || v != 42 {
+		t.Errorf("unexpected result %v, %v", v, err)
+	}
+	select {
+	case <-f.Done():
+	default:
+		t.Error("Done not closed")
+	}
+
+	failure := errors.New("failure")
+	if _, err := p.Submit(func() (interface{}, error) { return nil, failure }).Get(context.Background()); err != failure {
+		t.Errorf("expected the task error, got %v", err)
+	}
+
+	_, err := p.Submit(func() (interface{}, error) { panic("boom") }).Get(context.Background())
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "boom" || !strings.Contains(panicErr.Stack, "future_test.go") {
+		t.Errorf("expected a PanicError, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	slow := p.Submit(func() (interface{}, error) { time.Sleep(100 * time.Millisecond); return nil, nil })
+	if _, err = slow.Get(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestFutureCancel(t *testing.T) {
+	p := NewPool("cancel", 1, NewDefaultConfig())
+	release := make(chan struct{})
+	running := p.Submit(func() (interface{}, error) { <-release; return nil, nil })
+
+	var ran int32
+	queued := p.Submit(func() (interface{}, error) { atomic.StoreInt32(&ran, 1); return nil, nil })
+	if !queued.Cancel() {
+		t.Error("queued task not cancelled")
+	}
+	close(release)
+	if _, err := queued.Get(context.Background()); err != ErrCancelled {
+		t.Errorf("expected ErrCancelled, got %v", err)
+	}
+	if _, err := running.Get(context.Background()); err != nil || running.Cancel() {
+		t.Errorf("done task: %v", err)
+	}
+	_ = p.Wait(context.Background())
+	if atomic.LoadInt32(&ran) != 0 {
+		t.Error("cancelled task ran")
+	}
+
+	p.Close()
+	if _, err := p.Submit(func() (interface{}, error) { return nil, nil }).Get(context.Background()); err != ErrPoolClosed {
+		t.Errorf("expected ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestInvoke(t *testing.T) {
+	p := NewPool("invoke", 4, NewDefaultConfig())
+	tasks := []Callable{
+		func() (interface{}, error) { time.Sleep(20 * time.Millisecond); return 1, nil },
+		func() (interface{}, error) { return nil, errors.New("failure") },
+		func() (interface{}, error) { return 3, nil },
+	}
+
+	futures, err := InvokeAll(context.Background(), p, tasks)
+	if err != nil || len(futures) != 3 {
+		t.Fatalf("InvokeAll: %v", err)
+	}
+	for i, want := range []interface{}{1, nil, 3} {
+		if v, _ := futures[i].Get(context.Background()); v != want {
+			t.Errorf("future %d: expected %v, got %v", i, want, v)
+		}
+	}
+
+	if v, err := InvokeAny(context.Background(), p, tasks); err != nil || v != 3 {
+		t.Errorf("InvokeAny: %v, %v", v, err)
+	}
+	if _, err := InvokeAny(context.Background(), p, tasks[1:2]); err == nil || err.Error() != "failure" {
+		t.Errorf("InvokeAny: expected the last error, got %v", err)
+	}
+}
+
+func TestInvokeAnyGoroutines(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MinWorkers = 2
+	p := NewPool("invoke", 2, config)
+
+	// the futures notify InvokeAny, no goroutine waits for each of them
+	const tasks = 16
+	var started int32
+	release := make(chan struct{})
+	callables := make([]Callable, tasks)
+	for i := range callables {
+		callables[i] = func() (interface{}, error) {
+			atomic.AddInt32(&started, 1)
+			<-release
+			return nil, errors.New("failure")
+		}
+	}
+	base := runtime.NumGoroutine()
+	result := make(chan error, 1)
+	go func() {
+		_, err := InvokeAny(context.Background(), p, callables)
+		result <- err
+	}()
+	for atomic.LoadInt32(&started) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine() - base; n >= tasks {
+		t.Errorf("%d goroutines started for %d tasks", n, tasks)
+	}
+	close(release)
+	if err := <-result; err == nil || err.Error() != "failure" {
+		t.Errorf("InvokeAny: expected the last error, got %v", err)
+	}
+}
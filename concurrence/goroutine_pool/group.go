@@ -0,0 +1,153 @@
+package goroutine_pool
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/kisunSea/gopkg/runtime/traceback"
+)
+
+// GroupOptions controls a `Group`. A nil *GroupOptions keeps the first error only.
+type GroupOptions struct {
+	// CollectAll makes `Group.Wait` return a `MultiError` with the errors of
+	// all the tasks, in the order they were returned
+	CollectAll bool
+}
+
+// MultiError holds the errors of the tasks of a `Group`.
+type MultiError []error
+
+func (e MultiError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the errors matches `target`.
+func (e MultiError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error that matches `target`.
+func (e MultiError) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Group runs tasks on a pool like `errgroup.Group`: the first error cancels
+// the context of the group, and `Wait` returns it. A panic in a task is
+// turned into a `*PanicError`. The tasks share the capacity of the pool.
+type Group struct {
+	pool   *pool
+	ctx    context.Context
+	cancel context.CancelFunc
+	opts   GroupOptions
+
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+func (p *pool) Group(ctx context.Context) *Group {
+	return p.GroupWithOptions(ctx, nil)
+}
+
+func (p *pool) GroupWithOptions(ctx context.Context, opts *GroupOptions) *Group {
+	g := &Group{pool: p}
+	g.ctx, g.cancel = context.WithCancel(ctx)
+	if opts != nil {
+		g.opts = *opts
+	}
+	return g
+}
+
+// Context returns the context of the group, it is cancelled by the first
+// error or by `Wait`.
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// Go runs `f` in the pool with the context of the group. A task whose turn
+// comes after the context is cancelled is skipped.
+func (g *Group) Go(f func(ctx context.Context) error) {
+	g.wg.Add(1)
+	t := newPoolTask(g.ctx)
+	t.f = func() {
+		defer g.wg.Done()
+		if err := g.run(f); err != nil {
+			g.fail(err)
+		}
+	}
+	t.onCancel = func(err error) {
+		if g.ctx.Err() != nil {
+			g.skip(err)
+		} else {
+			// discarded, see `PolicyDiscardOldest`
+			g.fail(err)
+		}
+		g.wg.Done()
+	}
+	if err := g.pool.trySubmit(t); err != nil {
+		g.fail(err)
+		g.wg.Done()
+	}
+}
+
+func (g *Group) run(f func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: traceback.TakeStacktrace(1)}
+		}
+	}()
+	return f(g.ctx)
+}
+
+func (g *Group) fail(err error) {
+	g.mu.Lock()
+	if len(g.errs) == 0 || g.opts.CollectAll {
+		g.errs = append(g.errs, err)
+	}
+	g.mu.Unlock()
+	g.cancel()
+}
+
+// skip records the error of a skipped task if no task has failed, otherwise
+// the task was skipped because of that failure.
+func (g *Group) skip(err error) {
+	g.mu.Lock()
+	if len(g.errs) == 0 {
+		g.errs = append(g.errs, err)
+	}
+	g.mu.Unlock()
+}
+
+// Wait waits for all the tasks and cancels the context of the group. It
+// returns the first error, or a `MultiError` if `GroupOptions.CollectAll` is
+// set, or nil.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.errs) == 0 {
+		return nil
+	}
+	if g.opts.CollectAll {
+		return append(MultiError(nil), g.errs...)
+	}
+	return g.errs[0]
+}
@@ -0,0 +1,106 @@
+package goroutine_pool
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	p := NewPool("group", 4, NewDefaultConfig())
+
+	g := p.Group(context.Background())
+	var n int32
+	for i := 0; i < 20; i++ {
+		g.Go(func(ctx context.Context) error {
+			atomic.AddInt32(&n, 1)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil || n != 20 {
+		t.Fatalf("expected 20 tasks without error, got %d and %v", n, err)
+	}
+	if g.Context().Err() == nil {
+		t.Error("context not cancelled by Wait")
+	}
+
+	// the first error cancels the others
+	failure := errors.New("failure")
+	g = p.Group(context.Background())
+	g.Go(func(ctx context.Context) error { return failure })
+	g.Go(func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return errors.New("not cancelled")
+		}
+	})
+	if err := g.Wait(); err != failure {
+		t.Errorf("expected the first error, got %v", err)
+	}
+}
+
+func TestGroupCollectAll(t *testing.T) {
+	p := NewPool("group", 2, NewDefaultConfig())
+	g := p.GroupWithOptions(context.Background(), &GroupOptions{CollectAll: true})
+
+	failure := errors.New("failure")
+	started := make(chan struct{})
+	g.Go(func(ctx context.Context) error { close(started); <-ctx.Done(); return failure })
+	g.Go(func(ctx context.Context) error { <-started; panic("boom") })
+
+	err := g.Wait()
+	var multi MultiError
+	if !errors.As(err, &multi) || len(multi) != 2 {
+		t.Fatalf("expected a MultiError of 2 errors, got %v", err)
+	}
+	var panicErr *PanicError
+	if !errors.As(multi[0], &panicErr) || panicErr.Value != "boom" || multi[1] != failure {
+		t.Errorf("unexpected errors %v", err)
+	}
+	if !errors.Is(err, failure) || !errors.As(err, &panicErr) {
+		t.Errorf("MultiError does not match its errors")
+	}
+}
+
+func TestGroupPanic(t *testing.T) {
+	p := NewPool("group", 2, NewDefaultConfig())
+	g := p.Group(context.Background())
+	g.Go(func(ctx context.Context) error { panic("boom") })
+
+	err := g.Wait()
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "boom" || !strings.Contains(panicErr.Stack, "group_test.go") {
+		t.Errorf("expected a PanicError with its stack, got %v", err)
+	}
+	if s := p.Stats(); s.Panicked != 0 {
+		t.Error("a panic turned into an error counted as a panic")
+	}
+}
+
+func TestGroupCancelled(t *testing.T) {
+	p := NewPool("group", 1, NewDefaultConfig())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var ran int32
+	g := p.Group(ctx)
+	g.Go(func(ctx context.Context) error { atomic.StoreInt32(&ran, 1); return nil })
+	if err := g.Wait(); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if ran != 0 {
+		t.Error("task of a cancelled group ran")
+	}
+
+	p.Close()
+	g = p.Group(context.Background())
+	g.Go(func(ctx context.Context) error { return nil })
+	if err := g.Wait(); err != ErrPoolClosed {
+		t.Errorf("expected ErrPoolClosed, got %v", err)
+	}
+}
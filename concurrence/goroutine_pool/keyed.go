@@ -0,0 +1,152 @@
+package goroutine_pool
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/kisunSea/gopkg/logging"
+)
+
+// keyed tasks ...
+//
+// At most one task of a key is in the pool at a time, queued or running. The
+// next tasks of the key wait in its `keyedQueue` and the task that leaves the
+// pool, whether it returned, panicked, was skipped or was rejected, queues
+// the next one. Keyed tasks are regular tasks for the pool, they share its
+// capacity and its queue with the other tasks.
+//
+// Every keyed task goes through `QueueFullPolicy` in `CtxGoKeyed`, the tasks
+// waiting behind their key hold a queue slot like the queued ones, so that a
+// hot key cannot grow past `MaxQueueLen`. A task waiting behind its key cannot
+// run before them, `PolicyCallerRuns` waits for a slot instead. The waiting
+// tasks are queued with the slot they hold, even if the pool was closed in the
+// meantime, so that `Shutdown` waits for every task accepted by `CtxGoKeyed`
+// and a worker never blocks on a full queue.
+
+type keyedTask struct {
+	ctx context.Context
+	f   func()
+}
+
+// keyedQueue holds the tasks of a key waiting behind the one in the pool,
+// it is removed from `pool.keys` once empty.
+type keyedQueue struct {
+	pending []keyedTask
+}
+
+func (p *pool) GoKeyed(key string, f func()) {
+	p.CtxGoKeyed(context.Background(), key, f)
+}
+
+func (p *pool) CtxGoKeyed(ctx context.Context, key string, f func()) {
+	if p.isClosed() {
+		atomic.AddUint64(&p.stats.rejected, 1)
+		p.keyedRejected(key, ErrPoolClosed)
+		return
+	}
+	kt := keyedTask{ctx: ctx, f: f}
+	// the slot is taken without `keyLock`, the key may be released meanwhile
+	for held := false; ; held = true {
+		p.keyLock.Lock()
+		q, ok := p.keys[key]
+		if !ok {
+			p.keys[key] = &keyedQueue{}
+			p.keyLock.Unlock()
+			if held {
+				p.putKeyed(key, kt)
+			} else {
+				p.submitKeyed(key, kt)
+			}
+			return
+		}
+		if held || p.queueSlots == nil {
+			q.pending = append(q.pending, kt)
+			p.keyLock.Unlock()
+			return
+		}
+		p.keyLock.Unlock()
+
+		err := p.acquireKeyedSlot(ctx)
+		if err == nil && p.isClosed() {
+			p.releaseSlot()
+			err = ErrPoolClosed
+		}
+		if err != nil {
+			atomic.AddUint64(&p.stats.rejected, 1)
+			p.keyedRejected(key, err)
+			return
+		}
+	}
+}
+
+// acquireKeyedSlot takes a queue slot for a task waiting behind its key.
+func (p *pool) acquireKeyedSlot(ctx context.Context) error {
+	run, err := p.acquireSlot(ctx)
+	if run {
+		return p.queueSlots.Acquire(context.Background(), 1)
+	}
+	return err
+}
+
+// submitKeyed submits the first task of `key`.
+func (p *pool) submitKeyed(key string, kt keyedTask) {
+	if err := p.trySubmit(p.newKeyedTask(key, kt)); err != nil {
+		p.keyedRejected(key, err)
+		p.nextKeyed(key)
+	}
+}
+
+// putKeyed queues the first task of `key` with the queue slot it holds.
+func (p *pool) putKeyed(key string, kt keyedTask) {
+	t := p.newKeyedTask(key, kt)
+	if err := p.PutTask(t); err != nil {
+		p.releaseSlot()
+		t.Recycle()
+		atomic.AddUint64(&p.stats.rejected, 1)
+		p.keyedRejected(key, err)
+		p.nextKeyed(key)
+		return
+	}
+	p.startWorker()
+}
+
+// nextKeyed queues the next task of `key` with the queue slot it holds, or
+// removes the queue of `key` if it is empty.
+func (p *pool) nextKeyed(key string) {
+	p.keyLock.Lock()
+	q := p.keys[key]
+	if len(q.pending) == 0 {
+		delete(p.keys, key)
+		p.keyLock.Unlock()
+		return
+	}
+	kt := q.pending[0]
+	q.pending[0] = keyedTask{}
+	q.pending = q.pending[1:]
+	p.keyLock.Unlock()
+
+	p.enqueue(p.newKeyedTask(key, kt))
+	p.startWorker()
+}
+
+func (p *pool) newKeyedTask(key string, kt keyedTask) *task {
+	t := newPoolTask(kt.ctx)
+	t.f = func() {
+		defer p.nextKeyed(key)
+		kt.f()
+	}
+	t.onCancel = func(error) { p.nextKeyed(key) }
+	return t
+}
+
+func (p *pool) keyedRejected(key string, err error) {
+	logger.WarnT("GOPOOL: task rejected", logging.String("pool", p.name),
+		logging.String("key", key), logging.Err(err))
+}
+
+// keyCount returns the number of keys with a task in the pool.
+func (p *pool) keyCount() int {
+	p.keyLock.Lock()
+	defer p.keyLock.Unlock()
+	return len(p.keys)
+}
@@ -0,0 +1,196 @@
+package goroutine_pool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGoKeyed(t *testing.T) {
+	config := NewDefaultConfig()
+	config.ScaleThreshold = 1
+	p := NewPool("keyed", 8, config)
+
+	const keys, tasks = 4, 50
+	var (
+		mu      sync.Mutex
+		order   = make(map[string][]int)
+		running [keys]int32
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < tasks; i++ {
+		for k := 0; k < keys; k++ {
+			i, k := i, k
+			key := fmt.Sprintf("key-%d", k)
+			wg.Add(1)
+			p.GoKeyed(key, func() {
+				defer wg.Done()
+				if atomic.AddInt32(&running[k], 1) != 1 {
+					t.Errorf("overlapping tasks for `%s`", key)
+				}
+				time.Sleep(100 * time.Microsecond)
+				mu.Lock()
+				order[key] = append(order[key], i)
+				mu.Unlock()
+				atomic.AddInt32(&running[k], -1)
+			})
+		}
+	}
+	wg.Wait()
+
+	for key, seq := range order {
+		for i, v := range seq {
+			if v != i {
+				t.Fatalf("`%s` out of order: %v", key, seq)
+			}
+		}
+	}
+	if err := p.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.(*pool).keyCount(); n != 0 {
+		t.Errorf("%d key queues left", n)
+	}
+}
+
+func TestGoKeyedParallel(t *testing.T) {
+	p := NewPool("keyed", 2, NewDefaultConfig())
+
+	// two keys blocking each other would deadlock if they were serialized
+	a, b := make(chan struct{}), make(chan struct{})
+	done := make(chan struct{}, 2)
+	p.GoKeyed("a", func() { close(a); <-b; done <- struct{}{} })
+	p.GoKeyed("b", func() { <-a; close(b); done <- struct{}{} })
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("keys not run in parallel")
+		}
+	}
+}
+
+func TestGoKeyedSkipped(t *testing.T) {
+	p := NewPool("keyed", 1, NewDefaultConfig())
+	p.SetPanicHandler(func(context.Context, interface{}) {})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var n int32
+	done := make(chan struct{})
+	p.GoKeyed("k", func() { panic("boom") })
+	p.CtxGoKeyed(ctx, "k", func() { atomic.AddInt32(&n, 1) })
+	p.GoKeyed("k", func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("key stalled after a panicked or cancelled task")
+	}
+	if n != 0 {
+		t.Error("cancelled task run")
+	}
+
+	// new keyed tasks are rejected once the pool is closed
+	p.Close()
+	p.GoKeyed("k", func() {})
+	if err := p.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.(*pool).keyCount(); n != 0 {
+		t.Errorf("%d key queues left", n)
+	}
+}
+
+func TestGoKeyedShutdown(t *testing.T) {
+	p := NewPool("keyed", 2, NewDefaultConfig())
+
+	// the tasks queued behind a key before `Shutdown` still run
+	var n int32
+	release := make(chan struct{})
+	p.GoKeyed("k", func() { <-release; atomic.AddInt32(&n, 1) })
+	for i := 0; i < 4; i++ {
+		p.GoKeyed("k", func() { atomic.AddInt32(&n, 1) })
+	}
+	time.AfterFunc(10*time.Millisecond, func() { close(release) })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&n); n != 5 {
+		t.Errorf("%d of 5 keyed tasks run", n)
+	}
+}
+
+func TestGoKeyedBoundedQueue(t *testing.T) {
+	for _, policy := range []QueueFullPolicy{PolicyBlock, PolicyCallerRuns} {
+		config := NewDefaultConfig()
+		config.MaxQueueLen = 1
+		config.QueueFullPolicy = policy
+		p := NewPool("keyed", 1, config)
+
+		// the tasks waiting behind a key hold a queue slot, the submitter
+		// blocks once the queue is full but a worker never does
+		var n, submitted int32
+		started, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+		const tasks = 20
+		task := func() {
+			if atomic.AddInt32(&n, 1) == tasks {
+				close(done)
+			}
+		}
+		p.GoKeyed("key-0", func() { close(started); <-release; task() })
+		<-started
+		go func() {
+			for i := 1; i < tasks; i++ {
+				p.GoKeyed(fmt.Sprintf("key-%d", i%2), task)
+				atomic.AddInt32(&submitted, 1)
+			}
+		}()
+		time.Sleep(50 * time.Millisecond)
+		if s := atomic.LoadInt32(&submitted); s > 1 {
+			t.Errorf("policy %d: %d tasks accepted with MaxQueueLen 1", policy, s)
+		}
+		close(release)
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("policy %d: %d of %d keyed tasks run", policy, atomic.LoadInt32(&n), tasks)
+		}
+		if err := p.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGoKeyedHotKeyRejected(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MaxQueueLen = 2
+	config.QueueFullPolicy = PolicyReject
+	p := NewPool("keyed", 1, config)
+
+	// a hot key waits in the queue bounded by `MaxQueueLen`
+	var n int32
+	started, release := make(chan struct{}), make(chan struct{})
+	p.GoKeyed("k", func() { close(started); <-release })
+	<-started
+	for i := 0; i < 10; i++ {
+		p.GoKeyed("k", func() { atomic.AddInt32(&n, 1) })
+	}
+	close(release)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&n); n != 2 {
+		t.Errorf("%d hot key tasks run, want 2", n)
+	}
+	if r := p.Stats().Rejected; r != 8 {
+		t.Errorf("%d tasks rejected, want 8", r)
+	}
+	if n := p.(*pool).keyCount(); n != 0 {
+		t.Errorf("%d key queues left", n)
+	}
+}
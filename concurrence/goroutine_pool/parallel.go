@@ -0,0 +1,136 @@
+package goroutine_pool
+
+import (
+	"context"
+)
+
+// chunks per worker when the chunk size is not set, so that the workers
+// finishing early take over the chunks of the slow ones
+const defaultChunksPerWorker = 4
+
+// ParallelOptions controls the parallel helpers. A nil *ParallelOptions
+// splits the range in 4 chunks per worker of the pool.
+type ParallelOptions struct {
+	// ChunkSize is the number of indexes handled by a task
+	ChunkSize int
+}
+
+func (opts *ParallelOptions) chunkSize(p Pool, n int) int {
+	if opts != nil && opts.ChunkSize > 0 {
+		return opts.ChunkSize
+	}
+	var capacity int32
+	if c, ok := p.(interface{ Capacity() int32 }); ok {
+		capacity = c.Capacity()
+	} else {
+		capacity = p.Stats().Capacity
+	}
+	chunks := int(capacity) * defaultChunksPerWorker
+	if chunks < 1 {
+		chunks = 1
+	}
+	return (n + chunks - 1) / chunks
+}
+
+// parallelChunks runs `fn` on the chunks [lo, hi) of [0, n) of `size` indexes
+// in a `Group` of `p`, `c` is the index of the chunk. The first error cancels
+// the others.
+func parallelChunks(ctx context.Context, p Pool, n, size int,
+	fn func(ctx context.Context, c, lo, hi int) error) error {
+	g := p.Group(ctx)
+	for c, lo := 0, 0; lo < n; c, lo = c+1, lo+size {
+		c, lo, hi := c, lo, lo+size
+		if hi > n {
+			hi = n
+		}
+		g.Go(func(ctx context.Context) error { return fn(ctx, c, lo, hi) })
+	}
+	return g.Wait()
+}
+
+// ParallelFor calls `fn` for every index of [0, n) in the tasks of `p`, and
+// returns the first error. The first error, or `ctx` being done, stops the
+// calls that have not started yet.
+func ParallelFor(ctx context.Context, p Pool, n int, fn func(ctx context.Context, i int) error) error {
+	return ParallelForWithOptions(ctx, p, n, nil, fn)
+}
+
+// ParallelForWithOptions runs `fn` like `ParallelFor` according to `opts`.
+func ParallelForWithOptions(ctx context.Context, p Pool, n int, opts *ParallelOptions,
+	fn func(ctx context.Context, i int) error) error {
+	if n <= 0 {
+		return nil
+	}
+	return parallelChunks(ctx, p, n, opts.chunkSize(p, n), func(ctx context.Context, _, lo, hi int) error {
+		for i := lo; i < hi; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(ctx, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ParallelMap calls `fn` for every index of [0, n) like `ParallelFor`, and
+// returns the results in the order of the indexes. The results are nil if an
+// error is returned.
+func ParallelMap(ctx context.Context, p Pool, n int,
+	fn func(ctx context.Context, i int) (interface{}, error)) ([]interface{}, error) {
+	return ParallelMapWithOptions(ctx, p, n, nil, fn)
+}
+
+// ParallelMapWithOptions runs `fn` like `ParallelMap` according to `opts`.
+func ParallelMapWithOptions(ctx context.Context, p Pool, n int, opts *ParallelOptions,
+	fn func(ctx context.Context, i int) (interface{}, error)) ([]interface{}, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	results := make([]interface{}, n)
+	err := ParallelForWithOptions(ctx, p, n, opts, func(ctx context.Context, i int) error {
+		result, err := fn(ctx, i)
+		results[i] = result
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ParallelReduce splits [0, n) in chunks, reduces every chunk [lo, hi) with
+// `reduce` in the tasks of `p`, and then folds the results of the chunks with
+// `combine`, in the order of the chunks. So `combine` must be associative but
+// need not be commutative. It returns nil for an empty range.
+func ParallelReduce(ctx context.Context, p Pool, n int,
+	reduce func(ctx context.Context, lo, hi int) (interface{}, error),
+	combine func(acc, chunk interface{}) interface{}) (interface{}, error) {
+	return ParallelReduceWithOptions(ctx, p, n, nil, reduce, combine)
+}
+
+// ParallelReduceWithOptions reduces [0, n) like `ParallelReduce` according to `opts`.
+func ParallelReduceWithOptions(ctx context.Context, p Pool, n int, opts *ParallelOptions,
+	reduce func(ctx context.Context, lo, hi int) (interface{}, error),
+	combine func(acc, chunk interface{}) interface{}) (interface{}, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	size := opts.chunkSize(p, n)
+	partials := make([]interface{}, (n+size-1)/size)
+	err := parallelChunks(ctx, p, n, size, func(ctx context.Context, c, lo, hi int) error {
+		partial, err := reduce(ctx, lo, hi)
+		partials[c] = partial
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	acc := partials[0]
+	for _, partial := range partials[1:] {
+		acc = combine(acc, partial)
+	}
+	return acc, nil
+}
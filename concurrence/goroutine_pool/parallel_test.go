@@ -0,0 +1,126 @@
+package goroutine_pool
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParallelFor(t *testing.T) {
+	p := NewPool("parallel", 4, NewDefaultConfig())
+
+	seen := make([]int32, 1000)
+	err := ParallelFor(context.Background(), p, len(seen), func(ctx context.Context, i int) error {
+		atomic.AddInt32(&seen[i], 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, n := range seen {
+		if n != 1 {
+			t.Fatalf("index %d seen %d times", i, n)
+		}
+	}
+	if err := ParallelFor(context.Background(), p, 0, nil); err != nil {
+		t.Errorf("empty range: %v", err)
+	}
+
+	// the first error stops the indexes that have not started
+	failure := errors.New("failure")
+	var calls int32
+	err = ParallelForWithOptions(context.Background(), p, 1000, &ParallelOptions{ChunkSize: 10},
+		func(ctx context.Context, i int) error {
+			atomic.AddInt32(&calls, 1)
+			if i == 5 {
+				return failure
+			}
+			return nil
+		})
+	if err != failure {
+		t.Errorf("expected the error, got %v", err)
+	}
+	if calls == 1000 {
+		t.Error("the error did not stop the other indexes")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ParallelFor(ctx, p, 10, func(ctx context.Context, i int) error { return nil }); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestParallelMap(t *testing.T) {
+	p := NewPool("parallel", 4, NewDefaultConfig())
+
+	results, err := ParallelMapWithOptions(context.Background(), p, 100, &ParallelOptions{ChunkSize: 7},
+		func(ctx context.Context, i int) (interface{}, error) { return i * i, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		if result != i*i {
+			t.Fatalf("result %d: %v", i, result)
+		}
+	}
+
+	_, err = ParallelMap(context.Background(), p, 10, func(ctx context.Context, i int) (interface{}, error) {
+		if i == 3 {
+			panic("boom")
+		}
+		return i, nil
+	})
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Errorf("expected a PanicError, got %v", err)
+	}
+}
+
+func TestParallelReduce(t *testing.T) {
+	p := NewPool("parallel", 4, NewDefaultConfig())
+
+	// concatenation is not commutative, the chunks are combined in order
+	for _, size := range []int{0, 1, 3, 26, 100} {
+		result, err := ParallelReduceWithOptions(context.Background(), p, 26, &ParallelOptions{ChunkSize: size},
+			func(ctx context.Context, lo, hi int) (interface{}, error) {
+				s := ""
+				for i := lo; i < hi; i++ {
+					s += string(rune('a' + i))
+				}
+				return s, nil
+			},
+			func(acc, chunk interface{}) interface{} { return acc.(string) + chunk.(string) })
+		if err != nil || result != "abcdefghijklmnopqrstuvwxyz" {
+			t.Errorf("chunk size %d: unexpected result %v, %v", size, result, err)
+		}
+	}
+
+	sum, err := ParallelReduce(context.Background(), p, 1001,
+		func(ctx context.Context, lo, hi int) (interface{}, error) {
+			s := 0
+			for i := lo; i < hi; i++ {
+				s += i
+			}
+			return s, nil
+		},
+		func(acc, chunk interface{}) interface{} { return acc.(int) + chunk.(int) })
+	if err != nil || sum != 500500 {
+		t.Errorf("unexpected sum %v, %v", sum, err)
+	}
+
+	failure := errors.New("failure")
+	_, err = ParallelReduce(context.Background(), p, 100,
+		func(ctx context.Context, lo, hi int) (interface{}, error) {
+			if lo == 0 {
+				return nil, failure
+			}
+			return strconv.Itoa(lo), nil
+		},
+		func(acc, chunk interface{}) interface{} { return acc })
+	if err != failure {
+		t.Errorf("expected the error, got %v", err)
+	}
+}
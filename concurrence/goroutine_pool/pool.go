@@ -2,21 +2,118 @@ package goroutine_pool
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/kisunSea/gopkg/concurrence/semaphore"
+	"github.com/kisunSea/gopkg/logging"
+)
+
+var (
+	// ErrPoolClosed is the error of the tasks submitted after `Close`.
+	ErrPoolClosed = errors.New("goroutine pool is closed")
+	// ErrPoolFull is the error of the tasks rejected by `PolicyReject`.
+	ErrPoolFull = errors.New("goroutine pool is full")
 )
 
+// ShutdownError is returned by `Shutdown` when tasks are left at the deadline.
+type ShutdownError struct {
+	Pool string
+	// Queued is the number of tasks still waiting for a worker
+	Queued int32
+	// Running is the number of workers still running a task
+	Running int32
+	Err     error
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("shutdown pool `%s`: %d tasks queued, %d running: %v", e.Pool, e.Queued, e.Running, e.Err)
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
 type Pool interface {
 	// Name returns the corresponding pool name.
 	Name() string
 	// SetCap sets the goroutine capacity of the pool.
 	SetCap(cap int32)
+	// SetRateLimit sets the maximum number of task starts per second and the
+	// burst, see `Config.RateLimit`. A `limit` of 0 removes the limit.
+	SetRateLimit(limit float64, burst int32)
 	// Go executes f.
 	Go(f func())
-	// CtxGo executes f and accepts the context.
+	// CtxGo executes f and accepts the context, f is queued at the priority
+	// set by `WithPriority`, `PriorityNormal` by default.
 	CtxGo(ctx context.Context, f func())
+	// CtxGoPriority executes f like `CtxGo` at priority `prio`.
+	CtxGoPriority(ctx context.Context, prio Priority, f func())
+	// GoKeyed executes f after the tasks previously submitted with the same
+	// key, the tasks of a key run one at a time in FIFO order, the tasks of
+	// different keys in parallel.
+	GoKeyed(key string, f func())
+	// CtxGoKeyed executes f like `GoKeyed` and accepts the context, a task
+	// skipped because its context is done lets the next task of its key run.
+	CtxGoKeyed(ctx context.Context, key string, f func())
+	// GoAfter executes f after `d`, the returned handle cancels it. A scheduled
+	// task due while the task list is full is skipped, whatever `QueueFullPolicy`.
+	GoAfter(d time.Duration, f func()) *Scheduled
+	// GoAt executes f at `t`.
+	GoAt(t time.Time, f func()) *Scheduled
+	// GoEvery executes f every `interval` until it is cancelled or the pool
+	// is closed, the occurrences missed while the process was busy are skipped.
+	GoEvery(interval time.Duration, f func()) *Scheduled
+	// GoEveryWithOptions executes f like `GoEvery` according to `opts`.
+	GoEveryWithOptions(interval time.Duration, opts *ScheduleOptions, f func()) *Scheduled
+	// GoCron executes f at the times matched by the cron expression `spec`,
+	// e.g. `*/5 9-17 * * mon-fri`, according to `opts`.
+	GoCron(spec string, opts *ScheduleOptions, f func()) (*Scheduled, error)
+	// Group returns a group of tasks run in the pool with a context derived
+	// from ctx, see `Group`.
+	Group(ctx context.Context) *Group
+	// GroupWithOptions returns a group like `Group` according to `opts`.
+	GroupWithOptions(ctx context.Context, opts *GroupOptions) *Group
+	// CtxGoErr executes f like `CtxGo`. f gets ctx, bounded by the task
+	// timeout if any (see `WithTaskTimeout`). f is retried according to the
+	// retry policy if any (see `WithRetryPolicy`), and the error of its last
+	// attempt is counted in `Stats` and passed to the error handler.
+	CtxGoErr(ctx context.Context, f func(context.Context) error)
+	// TryGo executes f like `Go`, and returns the error of a rejected task,
+	// such as `ErrPoolFull` or `ErrPoolClosed`, instead of logging it.
+	TryGo(f func()) error
+	// CtxTryGo executes f like `CtxGo`, and returns the error of a rejected task.
+	CtxTryGo(ctx context.Context, f func()) error
+	// Submit executes f and returns the future of its result, a rejected task
+	// completes the future with the error of `TryGo`.
+	Submit(f Callable) *Future
+	// CtxSubmit executes f like `Submit` and accepts the context.
+	CtxSubmit(ctx context.Context, f Callable) *Future
 	// SetPanicHandler sets the panic handler.
 	SetPanicHandler(f func(context.Context, interface{}))
+	// SetCancelHandler sets the handler of the queued tasks whose context is
+	// done when a worker picks them, such tasks are skipped.
+	SetCancelHandler(f func(context.Context, error))
+	// SetErrorHandler sets the handler of the errors returned by the `CtxGoErr` tasks.
+	SetErrorHandler(f func(context.Context, error))
+	// Close stops accepting tasks, the tasks submitted later are rejected with
+	// `ErrPoolClosed`. The queued tasks still run, the delayed and periodic
+	// tasks are cancelled.
+	Close()
+	// Wait blocks until the task list is empty and all workers are idle, or
+	// until ctx is done.
+	Wait(ctx context.Context) error
+	// Shutdown closes the pool and waits for its tasks, it returns a
+	// `*ShutdownError` if tasks are left when ctx is done.
+	Shutdown(ctx context.Context) error
+	// QueueLen returns the number of tasks queued at priority `prio`.
+	QueueLen(prio Priority) int32
+	// Stats returns a snapshot of the state and the counters of the pool.
+	Stats() Stats
 }
 
 type pool struct {
@@ -27,17 +124,51 @@ type pool struct {
 	cap int32
 	// Configuration information
 	config *Config
-	// linked list of tasks
-	taskHead  *task
-	taskTail  *task
-	taskLock  sync.Mutex
+	// task queues, see `taskShard`, the tasks are spread over them in turn
+	shards    []taskShard
+	nextShard uint32
+	nextHome  uint32
 	taskCount int32
+	// taskLock guards the parked workers and the idle waiters
+	taskLock sync.Mutex
+	// queueSlots bounds the task list to `config.MaxQueueLen`, nil if unbounded
+	queueSlots *semaphore.Weighted
 
 	// Record the number of running workers
 	workerCount int32
+	// idleWorkers are parked until a task is queued, they are read and written
+	// under `taskLock`, idleCount is their number
+	idleWorkers []*worker
+	idleCount   int32
+
+	// keyLock guards keys, the queues of the keyed tasks, see `GoKeyed`
+	keyLock sync.Mutex
+	keys    map[string]*keyedQueue
+
+	// limiter bounds the task starts, see `Config.RateLimit`
+	limiter *rateLimiter
+	// sched holds the delayed and periodic tasks, see `GoAfter`
+	sched scheduler
+	// pendingRetries is the number of retries waiting in sched, see `RetryPolicy`
+	pendingRetries int32
+	// autoscaler adjusts cap if `config.Autoscale` is set, lastScale holds its
+	// last `AutoscaleEvent`
+	autoscaler *autoscaler
+	lastScale  atomic.Value
+
+	// closed is 1 once `Close` is called, it is written under `taskLock`
+	closed int32
+	// idleWaiters are closed when the pool becomes idle, see `Wait`
+	idleWaiters []chan struct{}
 
 	// This method will be called when the worker panic
 	panicHandler func(context.Context, interface{})
+	// called for the tasks skipped because their context is done
+	cancelHandler func(context.Context, error)
+	// called for the errors returned by the `CtxGoErr` tasks
+	errorHandler func(context.Context, error)
+
+	stats poolStats
 }
 
 func NewPool(name string, cap int32, config *Config) Pool {
@@ -45,7 +176,24 @@ func NewPool(name string, cap int32, config *Config) Pool {
 		name:   name,
 		cap:    cap,
 		config: config,
+		keys:   make(map[string]*keyedQueue),
+		sched:  scheduler{wake: make(chan struct{}, 1)},
+		shards: make([]taskShard, shardCount(cap, config)),
+	}
+	p.limiter = newRateLimiter(config.RateLimit, config.RateBurst)
+	if config.MaxQueueLen > 0 {
+		p.queueSlots = semaphore.NewWeighted(int64(config.MaxQueueLen))
+	}
+	// warm workers, they park at once
+	for i := int32(0); i < config.MinWorkers && i < cap; i++ {
+		p.incrWorkerCount()
+		p.newWorker().run()
 	}
+	if config.Autoscale != nil {
+		p.autoscaler = newAutoscaler(p, *config.Autoscale)
+		go p.autoscaler.run()
+	}
+	registerPool(p)
 	return p
 }
 
@@ -62,24 +210,257 @@ func (p *pool) Go(f func()) {
 }
 
 func (p *pool) CtxGo(ctx context.Context, f func()) {
-	t := taskPool.Get().(*task)
-	t.ctx = ctx
+	if err := p.CtxTryGo(ctx, f); err != nil {
+		logger.WarnT("GOPOOL: task rejected", logging.String("pool", p.name), logging.Err(err))
+	}
+}
+
+func (p *pool) CtxGoPriority(ctx context.Context, prio Priority, f func()) {
+	p.CtxGo(WithPriority(ctx, prio), f)
+}
+
+func (p *pool) TryGo(f func()) error {
+	return p.CtxTryGo(context.Background(), f)
+}
+
+func (p *pool) CtxTryGo(ctx context.Context, f func()) error {
+	t := newPoolTask(ctx)
 	t.f = f
+	return p.trySubmit(t)
+}
+
+func (p *pool) CtxGoErr(ctx context.Context, f func(context.Context) error) {
+	t := newPoolTask(ctx)
+	t.fe = f
+	if err := p.trySubmit(t); err != nil {
+		logger.WarnT("GOPOOL: task rejected", logging.String("pool", p.name), logging.Err(err))
+	}
+}
 
-	p.PutTask(t)
+// trySubmit queues `t`, or runs it if `PolicyCallerRuns` says so, or recycles
+// it and returns the error of the rejection.
+func (p *pool) trySubmit(t *task) (err error) {
+	defer func() {
+		if err != nil {
+			atomic.AddUint64(&p.stats.rejected, 1)
+		}
+	}()
+
+	if p.queueSlots != nil {
+		if p.isClosed() {
+			t.Recycle()
+			return ErrPoolClosed
+		}
+		if run, err := p.acquireSlot(t.ctx); err != nil || run {
+			if run {
+				if waited, reserved := p.waitRate(); reserved {
+					p.stats.rateWait.observe(waited)
+				}
+				p.runTask(t)
+			}
+			t.Recycle()
+			return err
+		}
+	}
+	return p.put(t)
+}
 
+// offer queues `t` like `trySubmit` but never waits for a queue slot nor runs
+// the task, whatever `config.QueueFullPolicy`, it returns `ErrPoolFull` if the
+// task list is full. The scheduler goroutine that serves every timer of the
+// pool submits this way, the caller counts the rejection.
+func (p *pool) offer(t *task) error {
+	if p.queueSlots != nil && !p.queueSlots.TryAcquire(1) {
+		t.Recycle()
+		return ErrPoolFull
+	}
+	return p.put(t)
+}
+
+// put queues `t`, which holds its queue slot if the task list is bounded, or
+// releases the slot, recycles `t` and returns the error of `PutTask`.
+func (p *pool) put(t *task) error {
+	if err := p.PutTask(t); err != nil {
+		p.releaseSlot()
+		t.Recycle()
+		return err
+	}
+
+	p.startWorker()
+	return nil
+}
+
+// acquireSlot takes a slot of the bounded task list for a task of `ctx`,
+// following `config.QueueFullPolicy`. `run` is true if the caller must run
+// the task.
+func (p *pool) acquireSlot(ctx context.Context) (run bool, err error) {
+	if p.queueSlots.TryAcquire(1) {
+		return false, nil
+	}
+	switch p.config.QueueFullPolicy {
+	case PolicyBlockCtx:
+		return false, p.queueSlots.Acquire(ctx, 1)
+	case PolicyReject:
+		return false, ErrPoolFull
+	case PolicyCallerRuns:
+		return true, nil
+	case PolicyDiscardOldest:
+		for !p.queueSlots.TryAcquire(1) {
+			// the slot of the discarded task is reused
+			if p.discardOldest() {
+				return false, nil
+			}
+			runtime.Gosched()
+		}
+		return false, nil
+	default:
+		return false, p.queueSlots.Acquire(context.Background(), 1)
+	}
+}
+
+func (p *pool) releaseSlot() {
+	if p.queueSlots != nil {
+		p.queueSlots.Release(1)
+	}
+}
+
+// discardOldest drops the oldest task of the lowest priority, it returns
+// false if the workers emptied the task lists first.
+func (p *pool) discardOldest() bool {
+	var t *task
+	for prio := PriorityLow; t == nil && prio <= PriorityHigh; prio++ {
+		for i := range p.shards {
+			if t = p.shards[i].popPriority(prio, &p.taskCount); t != nil {
+				break
+			}
+		}
+	}
+	if t == nil {
+		return false
+	}
+
+	atomic.AddUint64(&p.stats.rejected, 1)
+	logger.WarnT("GOPOOL: task discarded", logging.String("pool", p.name), logging.Err(ErrPoolFull))
+	if t.onCancel != nil {
+		t.onCancel(ErrPoolFull)
+	}
+	t.Recycle()
+	return true
+}
+
+// runTask runs `t`, or skips it if its context is done, see `SetCancelHandler`.
+func (p *pool) runTask(t *task) {
+	if t.ctx != nil {
+		if err := t.ctx.Err(); err != nil {
+			atomic.AddUint64(&p.stats.cancelled, 1)
+			if t.onCancel != nil {
+				t.onCancel(err)
+			}
+			if p.cancelHandler != nil {
+				p.cancelHandler(t.ctx, err)
+			}
+			return
+		}
+	}
+	if t.fe == nil {
+		p.execute(t.ctx, t.f)
+		return
+	}
+
+	var err error
+	if t.attempt == 0 {
+		t.firstRun = time.Now()
+	}
+	ctx, cancel := p.taskContext(t.ctx)
+	p.execute(t.ctx, func() { err = t.fe(ctx) })
+	cancel()
+	if err != nil && !p.retry(t, err) {
+		p.fail(t.ctx, err)
+	}
+}
+
+// taskContext returns the context given to a `CtxGoErr` task, with the
+// timeout set by `WithTaskTimeout` or `config.TaskTimeout`.
+func (p *pool) taskContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout, ok := taskTimeoutOf(ctx)
+	if !ok {
+		timeout = p.config.TaskTimeout
+	}
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// execute runs `f` and counts it, a panic is handled by `handlePanic`.
+func (p *pool) execute(ctx context.Context, f func()) {
+	atomic.AddInt32(&p.stats.running, 1)
+	start := time.Now()
+	defer func() {
+		p.stats.runTime.observe(time.Since(start))
+		atomic.AddInt32(&p.stats.running, -1)
+		if r := recover(); r != nil {
+			atomic.AddUint64(&p.stats.panicked, 1)
+			p.handlePanic(ctx, r)
+			return
+		}
+		atomic.AddUint64(&p.stats.completed, 1)
+	}()
+	f()
+}
+
+func (p *pool) handlePanic(ctx context.Context, r interface{}) {
+	logging.LogPanic(logger, r, &logging.RecoverOptions{
+		Message: "GOPOOL: panic in pool",
+		Fields: []logging.Field{
+			logging.String("pool", p.name),
+			logging.String("ctx", fmt.Sprint(ctx)),
+		},
+	})
+	if p.panicHandler != nil {
+		p.panicHandler(ctx, r)
+	}
+}
+
+func (p *pool) startWorker() {
+	if atomic.LoadInt32(&p.idleCount) > 0 {
+		p.taskLock.Lock()
+		w := p.popIdleWorker()
+		p.taskLock.Unlock()
+		if w != nil {
+			w.wake <- struct{}{}
+			return
+		}
+	}
 	if p.IsTrigger() {
 		p.incrWorkerCount()
-		w := workerPool.Get().(*worker)
-		w.pool = p
-		w.run()
+		p.newWorker().run()
 	}
 }
 
+// newWorker returns a worker attached to the next shard.
+func (p *pool) newWorker() *worker {
+	w := workerPool.Get().(*worker)
+	w.pool = p
+	w.home = atomic.AddUint32(&p.nextHome, 1)
+	return w
+}
+
 func (p *pool) SetPanicHandler(f func(context.Context, interface{})) {
 	p.panicHandler = f
 }
 
+func (p *pool) SetCancelHandler(f func(context.Context, error)) {
+	p.cancelHandler = f
+}
+
+func (p *pool) SetErrorHandler(f func(context.Context, error)) {
+	p.errorHandler = f
+}
+
 func (p *pool) taskCount_() int32 {
 	return atomic.LoadInt32(&p.taskCount)
 }
@@ -104,16 +485,184 @@ func (p *pool) decrWorkerCount() {
 	atomic.AddInt32(&p.workerCount, -1)
 }
 
-func (p *pool) PutTask(task_ *task) {
+func (p *pool) Close() {
+	p.sched.stop()
+	if p.autoscaler != nil {
+		p.autoscaler.close()
+	}
+	p.taskLock.Lock()
+	atomic.StoreInt32(&p.closed, 1)
+	// parked workers leave once the task list is empty
+	for w := p.popIdleWorker(); w != nil; w = p.popIdleWorker() {
+		w.wake <- struct{}{}
+	}
+	p.notifyIdle()
+	p.taskLock.Unlock()
+}
+
+// keepAlive reports whether a worker that found no task parks instead of
+// leaving. It must be called with `taskLock` held.
+func (p *pool) keepAlive() bool {
+	if p.isClosed() {
+		return false
+	}
+	return p.config.IdleTimeout > 0 || p.WorkerCount() <= p.config.MinWorkers
+}
+
+// parkWorker must be called with `taskLock` held.
+func (p *pool) parkWorker(w *worker) {
+	p.idleWorkers = append(p.idleWorkers, w)
+	atomic.AddInt32(&p.idleCount, 1)
+	p.notifyIdle()
+}
+
+// popIdleWorker returns the most recently parked worker, or nil. It must be
+// called with `taskLock` held.
+func (p *pool) popIdleWorker() *worker {
+	n := len(p.idleWorkers)
+	if n == 0 {
+		return nil
+	}
+	w := p.idleWorkers[n-1]
+	p.idleWorkers[n-1] = nil
+	p.idleWorkers = p.idleWorkers[:n-1]
+	atomic.AddInt32(&p.idleCount, -1)
+	return w
+}
+
+// unparkWorker removes `w` from the parked workers, it returns false if `w`
+// was not parked anymore. It must be called with `taskLock` held.
+func (p *pool) unparkWorker(w *worker) bool {
+	for i, idle := range p.idleWorkers {
+		if idle == w {
+			p.idleWorkers = append(p.idleWorkers[:i], p.idleWorkers[i+1:]...)
+			atomic.AddInt32(&p.idleCount, -1)
+			return true
+		}
+	}
+	return false
+}
+
+func (p *pool) Wait(ctx context.Context) error {
 	p.taskLock.Lock()
-	if p.taskHead == nil {
-		p.taskHead = task_
-		p.taskTail = task_
-	} else {
-		p.taskTail.next = task_
-		p.taskTail = task_
+	if p.isIdle() {
+		p.taskLock.Unlock()
+		return nil
 	}
+	idle := make(chan struct{})
+	p.idleWaiters = append(p.idleWaiters, idle)
 	p.taskLock.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		p.taskLock.Lock()
+		for i, ch := range p.idleWaiters {
+			if ch == idle {
+				p.idleWaiters = append(p.idleWaiters[:i], p.idleWaiters[i+1:]...)
+				break
+			}
+		}
+		p.taskLock.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (p *pool) Shutdown(ctx context.Context) error {
+	p.Close()
+	if err := p.Wait(ctx); err != nil {
+		return &ShutdownError{Pool: p.name, Queued: p.taskCount_(), Running: p.WorkerCount(), Err: err}
+	}
+	return nil
+}
+
+// oldestQueueWait returns the time spent in the task list by the oldest queued task.
+func (p *pool) oldestQueueWait(now time.Time) time.Duration {
+	var wait time.Duration
+	for i := range p.shards {
+		s := &p.shards[i]
+		s.mu.Lock()
+		for j := range s.tasks.lists {
+			if head := s.tasks.lists[j].head; head != nil && now.Sub(head.enqueued) > wait {
+				wait = now.Sub(head.enqueued)
+			}
+		}
+		s.mu.Unlock()
+	}
+	return wait
+}
+
+func (p *pool) QueueLen(prio Priority) int32 {
+	if !prio.valid() {
+		return 0
+	}
+	var n int32
+	for i := range p.shards {
+		s := &p.shards[i]
+		s.mu.Lock()
+		n += s.tasks.len(prio)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// popTask pops the next task of the shard `home`, or steals the next task of
+// another shard if it is empty. It returns nil if there is none.
+func (p *pool) popTask(home uint32) *task {
+	now := time.Now()
+	mask := uint32(len(p.shards) - 1)
+	for i := uint32(0); i <= mask; i++ {
+		if t := p.shards[(home+i)&mask].pop(now, p.config.AgingInterval, &p.taskCount); t != nil {
+			p.stats.queueWait.observe(now.Sub(t.enqueued))
+			return t
+		}
+	}
+	return nil
+}
+
+func (p *pool) isClosed() bool {
+	return atomic.LoadInt32(&p.closed) == 1
+}
+
+// isIdle must be called with `taskLock` held. Workers leave or park when the
+// task queue is empty, so when all of them are parked none is running a task.
+// A retry waiting for its backoff keeps the pool busy too.
+func (p *pool) isIdle() bool {
+	return p.taskCount_() == 0 && p.WorkerCount() == int32(len(p.idleWorkers)) &&
+		atomic.LoadInt32(&p.pendingRetries) == 0
+}
+
+// notifyIdle wakes up the waiters of an idle pool, a closed and idle pool
+// also leaves the registry of `AllStats`. It must be called with `taskLock` held.
+func (p *pool) notifyIdle() {
+	if !p.isIdle() {
+		return
+	}
+	for _, ch := range p.idleWaiters {
+		close(ch)
+	}
+	p.idleWaiters = nil
+	if p.isClosed() {
+		unregisterPool(p)
+	}
+}
+
+// PutTask appends `task_` to the task list of its priority in the next
+// shard, or returns `ErrPoolClosed`. The task is counted once it is in the
+// shard, so that a worker that sees it counted finds it, see `worker.rest`.
+func (p *pool) PutTask(task_ *task) error {
+	if p.isClosed() {
+		return ErrPoolClosed
+	}
+	p.enqueue(task_)
+	return nil
+}
+
+// enqueue pushes `t` to the task list, even if the pool is closed.
+func (p *pool) enqueue(t *task) {
+	t.enqueued = time.Now()
+	p.shards[atomic.AddUint32(&p.nextShard, 1)&uint32(len(p.shards)-1)].push(t)
 	p.incrTaskCount()
 }
 
@@ -15,6 +15,9 @@
 package goroutine_pool
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -96,3 +99,309 @@ func BenchmarkGo(b *testing.B) {
 		wg.Wait()
 	}
 }
+
+func BenchmarkPoolWarm(b *testing.B) {
+	config := NewDefaultConfig()
+	config.ScaleThreshold = 1
+	config.MinWorkers = int32(runtime.GOMAXPROCS(0))
+	p := NewPool("benchmark", int32(runtime.GOMAXPROCS(0)), config)
+	var wg sync.WaitGroup
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg.Add(benchmarkTimes)
+		for j := 0; j < benchmarkTimes; j++ {
+			p.Go(func() {
+				testFunc()
+				wg.Done()
+			})
+		}
+		wg.Wait()
+	}
+}
+
+// bursts of a few tasks, the workers of a cold pool leave between them
+func benchmarkBursts(b *testing.B, config *Config) {
+	config.ScaleThreshold = 1
+	p := NewPool("benchmark", int32(runtime.GOMAXPROCS(0)), config)
+	var wg sync.WaitGroup
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg.Add(4)
+		for j := 0; j < 4; j++ {
+			p.Go(func() {
+				testFunc()
+				wg.Done()
+			})
+		}
+		wg.Wait()
+	}
+}
+
+func BenchmarkPoolBursts(b *testing.B) {
+	benchmarkBursts(b, NewDefaultConfig())
+}
+
+func BenchmarkPoolBurstsWarm(b *testing.B) {
+	config := NewDefaultConfig()
+	config.MinWorkers = int32(runtime.GOMAXPROCS(0))
+	benchmarkBursts(b, config)
+}
+
+func BenchmarkGoBursts(b *testing.B) {
+	var wg sync.WaitGroup
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg.Add(4)
+		for j := 0; j < 4; j++ {
+			go func() {
+				testFunc()
+				wg.Done()
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// submissions from 1, 8 and 64 goroutines to a single task queue and to one
+// shard per P, the contention is on the task queue
+func BenchmarkPoolSubmitters(b *testing.B) {
+	for _, submitters := range []int{1, 8, 64} {
+		for _, shards := range []int32{1, -1} {
+			name := fmt.Sprintf("submitters=%d/shards=%d", submitters, shards)
+			b.Run(name, func(b *testing.B) {
+				config := NewDefaultConfig()
+				config.MinWorkers = int32(runtime.GOMAXPROCS(0))
+				config.Shards = shards
+				p := NewPool("benchmark", int32(runtime.GOMAXPROCS(0)), config)
+				var wg sync.WaitGroup
+				wg.Add(b.N)
+				task := func() { wg.Done() }
+				b.ReportAllocs()
+				b.ResetTimer()
+				var start sync.WaitGroup
+				start.Add(submitters)
+				for i := 0; i < submitters; i++ {
+					n := b.N / submitters
+					if i < b.N%submitters {
+						n++
+					}
+					go func(n int) {
+						defer start.Done()
+						for j := 0; j < n; j++ {
+							p.Go(task)
+						}
+					}(n)
+				}
+				start.Wait()
+				wg.Wait()
+				b.StopTimer()
+				_ = p.Shutdown(context.Background())
+			})
+		}
+	}
+}
+
+func TestPoolMinWorkers(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MinWorkers = 3
+	p := NewPool("warm", 8, config)
+	if n := p.Stats().Workers; n != 3 {
+		t.Fatalf("pre-started workers: %d", n)
+	}
+	// parked workers do not keep the pool busy
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int32
+	for i := 0; i < 100; i++ {
+		p.Go(func() { atomic.AddInt32(&n, 1) })
+	}
+	if err := p.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 {
+		t.Fatal(n)
+	}
+	if n := p.Stats().Workers; n < 3 {
+		t.Fatalf("warm workers left: %d", n)
+	}
+
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.Stats().Workers; n != 0 {
+		t.Fatalf("workers after shutdown: %d", n)
+	}
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	config := NewDefaultConfig()
+	config.ScaleThreshold = 1
+	config.MinWorkers = 1
+	config.IdleTimeout = 50 * time.Millisecond
+	p := NewPool("idle", 4, config)
+
+	release := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		p.Go(func() { <-release })
+	}
+	if n := p.Stats().Workers; n != 4 {
+		t.Fatalf("workers: %d", n)
+	}
+	close(release)
+
+	// the extra workers park, and then leave after the idle timeout
+	time.Sleep(10 * time.Millisecond)
+	if n := p.Stats().Workers; n != 4 {
+		t.Fatalf("parked workers: %d", n)
+	}
+	deadline := time.Now().Add(time.Second)
+	for p.Stats().Workers > 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := p.Stats().Workers; n != 1 {
+		t.Fatalf("workers after the idle timeout: %d", n)
+	}
+
+	// the parked worker runs the next task
+	done := make(chan struct{})
+	p.Go(func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("task not run")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolShutdown(t *testing.T) {
+	p := NewPool("shutdown", 4, NewDefaultConfig())
+	if err := p.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int32
+	for i := 0; i < 20; i++ {
+		p.Go(func() {
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&n, 1)
+		})
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n != 20 {
+		t.Errorf("expected 20 tasks done, got %d", n)
+	}
+
+	p.Go(func() { atomic.AddInt32(&n, 1) })
+	if err := p.Wait(context.Background()); err != nil || atomic.LoadInt32(&n) != 20 {
+		t.Errorf("task run after Close: %v, %d", err, n)
+	}
+}
+
+func TestPoolShutdownDeadline(t *testing.T) {
+	p := NewPool("deadline", 1, NewDefaultConfig())
+	release := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		p.Go(func() { <-release })
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := p.Shutdown(ctx)
+	var shutdownErr *ShutdownError
+	if !errors.As(err, &shutdownErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if shutdownErr.Queued != 2 || shutdownErr.Running != 1 {
+		t.Errorf("expected 2 queued and 1 running, got %d and %d", shutdownErr.Queued, shutdownErr.Running)
+	}
+
+	close(release)
+	if err = p.Wait(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPoolQueueFullPolicies(t *testing.T) {
+	newFullPool := func(policy QueueFullPolicy) (Pool, chan struct{}) {
+		config := NewDefaultConfig()
+		config.MaxQueueLen = 2
+		config.QueueFullPolicy = policy
+		p := NewPool("bounded", 1, config)
+
+		release, started := make(chan struct{}), make(chan struct{})
+		p.Go(func() { close(started); <-release })
+		<-started
+		// the worker is busy, fill the task list
+		p.Go(func() {})
+		p.Go(func() {})
+		return p, release
+	}
+
+	p, release := newFullPool(PolicyReject)
+	if err := p.TryGo(func() {}); err != ErrPoolFull {
+		t.Errorf("PolicyReject: expected ErrPoolFull, got %v", err)
+	}
+	close(release)
+	_ = p.Wait(context.Background())
+	if err := p.TryGo(func() {}); err != nil {
+		t.Errorf("PolicyReject: %v after the list is drained", err)
+	}
+
+	p, release = newFullPool(PolicyCallerRuns)
+	var ranInCaller bool
+	if err := p.TryGo(func() { ranInCaller = true }); err != nil || !ranInCaller {
+		t.Errorf("PolicyCallerRuns: %v, ran in caller %v", err, ranInCaller)
+	}
+	close(release)
+
+	p, release = newFullPool(PolicyBlockCtx)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.CtxTryGo(ctx, func() {}); err != context.DeadlineExceeded {
+		t.Errorf("PolicyBlockCtx: expected context.DeadlineExceeded, got %v", err)
+	}
+	close(release)
+
+	p, release = newFullPool(PolicyBlock)
+	blocked := make(chan error)
+	go func() { blocked <- p.TryGo(func() {}) }()
+	select {
+	case err := <-blocked:
+		t.Fatalf("PolicyBlock: not blocked, %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-blocked; err != nil {
+		t.Errorf("PolicyBlock: %v", err)
+	}
+
+	p, release = newFullPool(PolicyDiscardOldest)
+	var last int32
+	for i := int32(1); i <= 5; i++ {
+		i := i
+		if err := p.TryGo(func() { atomic.StoreInt32(&last, i) }); err != nil {
+			t.Errorf("PolicyDiscardOldest: %v", err)
+		}
+	}
+	close(release)
+	if err := p.Shutdown(context.Background()); err != nil || atomic.LoadInt32(&last) != 5 {
+		t.Errorf("PolicyDiscardOldest: %v, last task %d", err, last)
+	}
+	if err := p.TryGo(func() {}); err != ErrPoolClosed {
+		t.Errorf("expected ErrPoolClosed, got %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package goroutine_pool
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultAgingInterval = time.Second
+
+// Priority of a task, workers run the queued tasks of the highest priority first.
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+
+	priorityLevels = int(PriorityHigh) + 1
+)
+
+func (prio Priority) String() string {
+	switch prio {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	}
+	return "unknown"
+}
+
+func (prio Priority) valid() bool {
+	return prio >= PriorityLow && prio <= PriorityHigh
+}
+
+type priorityCtxKey struct{}
+
+// WithPriority returns a copy of `ctx` carrying `prio`, the tasks submitted
+// with the returned context are queued at `prio`.
+func WithPriority(ctx context.Context, prio Priority) context.Context {
+	return context.WithValue(ctx, priorityCtxKey{}, prio)
+}
+
+// priorityOf returns the priority carried by `ctx`, `PriorityNormal` by default.
+func priorityOf(ctx context.Context) Priority {
+	if ctx != nil {
+		if prio, ok := ctx.Value(priorityCtxKey{}).(Priority); ok && prio.valid() {
+			return prio
+		}
+	}
+	return PriorityNormal
+}
+
+// taskList is a FIFO linked list of tasks.
+type taskList struct {
+	head *task
+	tail *task
+	len  int32
+}
+
+func (l *taskList) push(t *task) {
+	if l.head == nil {
+		l.head = t
+		l.tail = t
+	} else {
+		l.tail.next = t
+		l.tail = t
+	}
+	l.len++
+}
+
+func (l *taskList) pop() *task {
+	t := l.head
+	if t != nil {
+		l.head = t.next
+		if l.head == nil {
+			l.tail = nil
+		}
+		t.next = nil
+		l.len--
+	}
+	return t
+}
+
+// taskQueue holds a task list per priority, it must be used with the lock of
+// its `taskShard` held.
+//
+// Aging prevents starvation: a task gains one priority level for every
+// `aging` it waits, so that a low-priority task waiting for 2*aging competes
+// with the new high-priority tasks, the oldest of equal priorities first.
+type taskQueue struct {
+	lists [priorityLevels]taskList
+}
+
+func (q *taskQueue) enqueue(t *task) {
+	q.lists[t.priority].push(t)
+}
+
+// dequeue pops the head of the list whose head has the highest effective
+// priority, see `taskQueue`. It returns nil if the queue is empty.
+func (q *taskQueue) dequeue(now time.Time, aging time.Duration) *task {
+	var (
+		best     = -1
+		bestPrio Priority
+	)
+	for i := priorityLevels - 1; i >= 0; i-- {
+		head := q.lists[i].head
+		if head == nil {
+			continue
+		}
+		prio := head.priority
+		if aging > 0 {
+			if prio += Priority(now.Sub(head.enqueued) / aging); prio > PriorityHigh {
+				prio = PriorityHigh
+			}
+		}
+		if best < 0 || prio > bestPrio ||
+			(prio == bestPrio && head.enqueued.Before(q.lists[best].head.enqueued)) {
+			best, bestPrio = i, prio
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	return q.lists[best].pop()
+}
+
+func (q *taskQueue) empty() bool {
+	for i := range q.lists {
+		if q.lists[i].head != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *taskQueue) len(prio Priority) int32 {
+	return q.lists[prio].len
+}
+
+// taskShard is a task queue with its own lock. The tasks are spread over the
+// shards of the pool so that the submitters and the workers do not all
+// contend on a single lock, a worker pops the shard it is attached to and
+// steals from the others when its shard is empty.
+//
+// The priorities, the aging and the oldest task dropped by `PolicyDiscardOldest`
+// hold within a shard. A pool has a single shard and runs its tasks in the
+// strict order of `taskQueue` unless `Config.Shards` trades it for throughput.
+type taskShard struct {
+	mu    sync.Mutex
+	tasks taskQueue
+	// n is the number of tasks, written under mu and read atomically so that
+	// the workers skip the empty shards without locking them
+	n int32
+	_ [64]byte // keeps the shards on different cache lines
+}
+
+func (s *taskShard) push(t *task) {
+	s.mu.Lock()
+	s.tasks.enqueue(t)
+	atomic.AddInt32(&s.n, 1)
+	s.mu.Unlock()
+}
+
+// pop dequeues a task, and uncounts it from `count` under the lock of the shard.
+func (s *taskShard) pop(now time.Time, aging time.Duration, count *int32) *task {
+	if atomic.LoadInt32(&s.n) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.tasks.dequeue(now, aging)
+	if t != nil {
+		atomic.AddInt32(&s.n, -1)
+		atomic.AddInt32(count, -1)
+	}
+	return t
+}
+
+// popPriority pops the oldest task of priority `prio`, and uncounts it from `count`.
+func (s *taskShard) popPriority(prio Priority, count *int32) *task {
+	if atomic.LoadInt32(&s.n) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.tasks.lists[prio].pop()
+	if t != nil {
+		atomic.AddInt32(&s.n, -1)
+		atomic.AddInt32(count, -1)
+	}
+	return t
+}
+
+// shardCount returns the number of shards of a pool: one unless `config.Shards`
+// asks for more, or one per P but no more than the workers that can run if it
+// is negative. It is rounded down to a power of 2.
+func shardCount(cap int32, config *Config) int {
+	n := config.Shards
+	if n < 0 {
+		n = int32(runtime.GOMAXPROCS(0))
+		max := cap
+		if config.Autoscale != nil && config.Autoscale.MaxCap > max {
+			max = config.Autoscale.MaxCap
+		}
+		if max < n {
+			n = max
+		}
+	}
+	shards := 1
+	for int32(shards*2) <= n {
+		shards *= 2
+	}
+	return shards
+}
@@ -0,0 +1,222 @@
+package goroutine_pool
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolPriority(t *testing.T) {
+	config := NewDefaultConfig()
+	config.AgingInterval = 0
+	p := NewPool("priority", 1, config)
+
+	release, started := make(chan struct{}), make(chan struct{})
+	p.Go(func() { close(started); <-release })
+	<-started
+
+	var (
+		mu    sync.Mutex
+		order []Priority
+	)
+	record := func(prio Priority) func() {
+		return func() {
+			mu.Lock()
+			order = append(order, prio)
+			mu.Unlock()
+		}
+	}
+	p.CtxGoPriority(context.Background(), PriorityLow, record(PriorityLow))
+	p.Go(record(PriorityNormal))
+	p.CtxGo(WithPriority(context.Background(), PriorityHigh), record(PriorityHigh))
+	p.CtxGoPriority(context.Background(), PriorityHigh, record(PriorityHigh))
+
+	if p.QueueLen(PriorityHigh) != 2 || p.QueueLen(PriorityNormal) != 1 || p.QueueLen(PriorityLow) != 1 {
+		t.Errorf("unexpected queue lengths %d/%d/%d",
+			p.QueueLen(PriorityHigh), p.QueueLen(PriorityNormal), p.QueueLen(PriorityLow))
+	}
+	close(release)
+	if err := p.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Priority{PriorityHigh, PriorityHigh, PriorityNormal, PriorityLow}
+	for i := range want {
+		if i >= len(order) || order[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, order)
+		}
+	}
+}
+
+// the order of the tasks does not depend on the number of Ps
+func TestPoolPriorityManyProcs(t *testing.T) {
+	procs := runtime.GOMAXPROCS(4)
+	defer runtime.GOMAXPROCS(procs)
+
+	config := NewDefaultConfig()
+	config.AgingInterval = 0
+	config.ScaleThreshold = 1000
+	config.MaxQueueLen = 8
+	config.QueueFullPolicy = PolicyDiscardOldest
+	p := NewPool("priority", 4, config)
+
+	release, started := make(chan struct{}), make(chan struct{})
+	p.Go(func() { close(started); <-release })
+	<-started
+
+	var (
+		mu    sync.Mutex
+		order []int
+	)
+	record := func(i int) func() {
+		return func() {
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+		}
+	}
+	// 0-4 are low, 5-8 are high, the oldest low task 0 is discarded by 8
+	for i := 0; i < 9; i++ {
+		prio := PriorityLow
+		if i >= 5 {
+			prio = PriorityHigh
+		}
+		p.CtxGoPriority(context.Background(), prio, record(i))
+	}
+	close(release)
+	if err := p.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int{5, 6, 7, 8, 1, 2, 3, 4}
+	if len(order) != len(want) {
+		t.Fatalf("expected %v, got %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, order)
+		}
+	}
+}
+
+func TestTaskQueueAging(t *testing.T) {
+	var (
+		q     taskQueue
+		now   = time.Now()
+		aging = time.Second
+	)
+	low := &task{priority: PriorityLow, enqueued: now.Add(-2500 * time.Millisecond)}
+	normal := &task{priority: PriorityNormal, enqueued: now.Add(-500 * time.Millisecond)}
+	high := &task{priority: PriorityHigh, enqueued: now}
+	q.enqueue(high)
+	q.enqueue(normal)
+	q.enqueue(low)
+
+	// low waited 2.5 intervals, it is as urgent as high and older
+	for _, want := range []*task{low, high, normal} {
+		if got := q.dequeue(now, aging); got != want {
+			t.Fatalf("expected the %v task, got %v", want.priority, got.priority)
+		}
+	}
+	if !q.empty() || q.dequeue(now, aging) != nil {
+		t.Error("queue not empty")
+	}
+
+	// without aging, priorities are strict
+	q.enqueue(low)
+	q.enqueue(high)
+	if q.dequeue(now, 0) != high {
+		t.Error("expected the high task first without aging")
+	}
+}
+
+func TestShardCount(t *testing.T) {
+	procs := runtime.GOMAXPROCS(4)
+	defer runtime.GOMAXPROCS(procs)
+
+	config := NewDefaultConfig()
+	for _, tc := range []struct {
+		cap, shards, autoscale int32
+		want                   int
+	}{
+		{cap: 100, want: 1},
+		{cap: 100, shards: 1, want: 1},
+		{cap: 100, shards: 6, want: 4},
+		{cap: 100, shards: 16, want: 16},
+		{cap: 1, shards: -1, want: 1},
+		{cap: 3, shards: -1, want: 2},
+		{cap: 100, shards: -1, want: 4},
+		{cap: 2, shards: -1, autoscale: 64, want: 4},
+	} {
+		config.Shards, config.Autoscale = tc.shards, nil
+		if tc.autoscale > 0 {
+			config.Autoscale = &AutoscaleConfig{MaxCap: tc.autoscale}
+		}
+		if n := shardCount(tc.cap, config); n != tc.want {
+			t.Errorf("%+v: expected %d shards, got %d", tc, tc.want, n)
+		}
+	}
+}
+
+func TestPoolShards(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Shards = 8
+	p := NewPool("shards", 2, config)
+
+	// 2 workers drain the 8 shards by stealing
+	var wg sync.WaitGroup
+	var n int32
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		p.Go(func() {
+			atomic.AddInt32(&n, 1)
+			wg.Done()
+		})
+	}
+	wg.Wait()
+	if n != 1000 {
+		t.Fatal(n)
+	}
+	if err := p.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := p.Stats(); s.Queued != 0 || s.Workers != 0 {
+		t.Errorf("expected an empty pool, got %d queued and %d workers", s.Queued, s.Workers)
+	}
+}
+
+// the workers leave or park while tasks are submitted from many goroutines,
+// no task must be stranded in the queue
+func TestPoolNoStrandedTask(t *testing.T) {
+	for _, config := range []*Config{
+		{ScaleThreshold: 1000},
+		{ScaleThreshold: 1000, MinWorkers: 1},
+		{ScaleThreshold: 1000, IdleTimeout: time.Millisecond},
+	} {
+		config.Shards = 4
+		p := NewPool("stranded", 4, config)
+		for round := 0; round < 200; round++ {
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go p.Go(wg.Done)
+			}
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%+v: task stranded at round %d", config, round)
+			}
+		}
+		if err := p.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
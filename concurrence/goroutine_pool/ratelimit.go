@@ -0,0 +1,101 @@
+package goroutine_pool
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimiter is a token bucket that bounds the task starts, see
+// `Config.RateLimit`. A start that finds no token reserves one in advance, the
+// bucket goes negative and the caller waits until the token is due.
+type rateLimiter struct {
+	limited int32 // 1 if the rate is limited, read atomically on the fast path
+
+	mu     sync.Mutex
+	limit  float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(limit float64, burst int32) *rateLimiter {
+	l := &rateLimiter{}
+	l.set(limit, burst, time.Now())
+	return l
+}
+
+func (l *rateLimiter) set(limit float64, burst int32, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(now)
+	if burst < 1 {
+		burst = 1
+	}
+	if l.limit <= 0 || l.tokens > float64(burst) {
+		l.tokens = float64(burst)
+	}
+	l.limit, l.burst = limit, float64(burst)
+	if limit > 0 {
+		atomic.StoreInt32(&l.limited, 1)
+	} else {
+		atomic.StoreInt32(&l.limited, 0)
+	}
+}
+
+// advance adds the tokens earned since the last call, it must be called with `mu` held.
+func (l *rateLimiter) advance(now time.Time) {
+	if !now.After(l.last) {
+		return
+	}
+	if l.limit > 0 {
+		if l.tokens += now.Sub(l.last).Seconds() * l.limit; l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+// reserve takes a token and returns how long to wait before using it.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit <= 0 {
+		return 0
+	}
+	l.advance(now)
+	if l.tokens--; l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.limit * float64(time.Second))
+}
+
+// refund gives back a token that was not used.
+func (l *rateLimiter) refund() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit > 0 {
+		if l.tokens++; l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+}
+
+func (p *pool) SetRateLimit(limit float64, burst int32) {
+	p.limiter.set(limit, burst, time.Now())
+}
+
+// waitRate blocks until the rate limit lets a task start. `reserved` is false
+// if the rate is not limited, otherwise the caller must either start a task
+// or refund the token.
+func (p *pool) waitRate() (waited time.Duration, reserved bool) {
+	if atomic.LoadInt32(&p.limiter.limited) == 0 {
+		return 0, false
+	}
+	start := time.Now()
+	if d := p.limiter.reserve(start); d > 0 {
+		time.Sleep(d)
+		return time.Since(start), true
+	}
+	return 0, true
+}
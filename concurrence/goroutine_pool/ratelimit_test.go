@@ -0,0 +1,73 @@
+package goroutine_pool
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := &rateLimiter{}
+	l.set(10, 2, now)
+	for i := 0; i < 2; i++ {
+		if d := l.reserve(now); d != 0 {
+			t.Fatalf("burst token %d: wait %v", i, d)
+		}
+	}
+	if d := l.reserve(now); d != 100*time.Millisecond {
+		t.Fatalf("expected a wait of 100ms, got %v", d)
+	}
+	if d := l.reserve(now); d != 200*time.Millisecond {
+		t.Fatalf("expected a wait of 200ms, got %v", d)
+	}
+	l.refund()
+	if d := l.reserve(now.Add(100 * time.Millisecond)); d != 100*time.Millisecond {
+		t.Fatalf("expected a wait of 100ms after the refund, got %v", d)
+	}
+
+	l.set(0, 0, now)
+	if d := l.reserve(now); d != 0 {
+		t.Fatalf("unlimited: wait %v", d)
+	}
+}
+
+func TestPoolRateLimit(t *testing.T) {
+	config := NewDefaultConfig()
+	config.ScaleThreshold = 1
+	config.RateLimit = 100
+	config.RateBurst = 5
+	p := NewPool("rate", 8, config)
+
+	const tasks = 25
+	var wg sync.WaitGroup
+	start := time.Now()
+	wg.Add(tasks)
+	for i := 0; i < tasks; i++ {
+		p.Go(wg.Done)
+	}
+	wg.Wait()
+	// 5 tasks start at once, the next 20 at 100 per second
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("%d tasks started in %v", tasks, elapsed)
+	}
+	if s := p.Stats(); s.RateWait.Count == 0 || s.RateWait.Sum <= 0 {
+		t.Errorf("rate wait not observed: %+v", s.RateWait)
+	}
+
+	p.SetRateLimit(0, 0)
+	start = time.Now()
+	wg.Add(tasks)
+	for i := 0; i < tasks; i++ {
+		p.Go(wg.Done)
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("%d tasks started in %v without a limit", tasks, elapsed)
+	}
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,151 @@
+package goroutine_pool
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/kisunSea/gopkg/logging"
+)
+
+const (
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultRetryMultiplier = 2
+)
+
+// RetryPolicy retries the `CtxGoErr` tasks that return an error, see
+// `Config.RetryPolicy` and `WithRetryPolicy`. A retry waits in the timer heap
+// of the pool, not in a worker, and is queued again when its backoff is over.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one, a task
+	// is not retried if it is less than 2
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, 100ms by default,
+	// it is multiplied by Multiplier (2 by default) at each retry up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the fraction of the backoff that is random, from 0 to 1
+	Jitter float64
+	// Retryable reports whether an error is worth a retry, all errors are by default
+	Retryable func(err error) bool
+	// Deadline bounds the time from the first attempt to the start of the
+	// last retry, 0 means no deadline
+	Deadline time.Duration
+}
+
+// backoff returns the wait before the retry that follows attempt `attempt`, from 1.
+func (rp *RetryPolicy) backoff(attempt int) time.Duration {
+	initial, multiplier := rp.InitialBackoff, rp.Multiplier
+	if initial <= 0 {
+		initial = defaultRetryBackoff
+	}
+	if multiplier < 1 {
+		multiplier = defaultRetryMultiplier
+	}
+	d := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if rp.MaxBackoff > 0 && d > float64(rp.MaxBackoff) {
+		d = float64(rp.MaxBackoff)
+	}
+	if rp.Jitter > 0 {
+		d -= d * math.Min(rp.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+type retryPolicyCtxKey struct{}
+
+// WithRetryPolicy returns a copy of `ctx` carrying `policy`, the `CtxGoErr`
+// tasks submitted with the returned context are retried according to it. It
+// overrides `Config.RetryPolicy`, a nil policy disables the retries.
+func WithRetryPolicy(ctx context.Context, policy *RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyCtxKey{}, policy)
+}
+
+func (p *pool) retryPolicy(ctx context.Context) *RetryPolicy {
+	if ctx != nil {
+		if policy, ok := ctx.Value(retryPolicyCtxKey{}).(*RetryPolicy); ok {
+			return policy
+		}
+	}
+	return p.config.RetryPolicy
+}
+
+// retry schedules the next attempt of the failed task `t`, it returns false
+// if the task is not retried and has failed for good.
+func (p *pool) retry(t *task, err error) bool {
+	policy := p.retryPolicy(t.ctx)
+	attempt := t.attempt + 1
+	if policy == nil || attempt >= policy.MaxAttempts {
+		return false
+	}
+	if policy.Retryable != nil && !policy.Retryable(err) {
+		return false
+	}
+	if t.ctx != nil && t.ctx.Err() != nil {
+		return false
+	}
+	backoff := policy.backoff(attempt)
+	if policy.Deadline > 0 && time.Since(t.firstRun)+backoff > policy.Deadline {
+		return false
+	}
+
+	ctx, fe, firstRun := t.ctx, t.fe, t.firstRun
+	s := &Scheduled{pool: p, at: time.Now().Add(backoff), index: -1}
+	s.submit = func() {
+		next := newPoolTask(ctx)
+		next.fe = fe
+		next.attempt = attempt
+		next.firstRun = firstRun
+		err := p.offer(next)
+		if err == ErrPoolFull && (policy.Deadline <= 0 || time.Since(firstRun)+backoff <= policy.Deadline) &&
+			p.reschedule(s, backoff) {
+			// the attempt waits for the task list to drain, it is still pending
+			return
+		}
+		if err != nil {
+			atomic.AddUint64(&p.stats.rejected, 1)
+			logger.WarnT("GOPOOL: task retry rejected", logging.String("pool", p.name),
+				logging.Int("attempt", attempt+1), logging.Err(err))
+			p.fail(ctx, err)
+		}
+		p.retryDone()
+	}
+	// the pool was closed before the retry
+	s.onStop = func() {
+		p.fail(ctx, err)
+		p.retryDone()
+	}
+
+	p.sched.mu.Lock()
+	defer p.sched.mu.Unlock()
+	if p.sched.closed {
+		return false
+	}
+	atomic.AddInt32(&p.pendingRetries, 1)
+	p.sched.add(p, s)
+	atomic.AddUint64(&p.stats.retried, 1)
+	logger.WarnT("GOPOOL: task failed, retrying", logging.String("pool", p.name),
+		logging.Int("attempt", attempt), logging.Duration("backoff", backoff), logging.Err(err))
+	return true
+}
+
+// retryDone accounts for a retry that left the timer heap, the pool is not
+// idle while retries are pending.
+func (p *pool) retryDone() {
+	atomic.AddInt32(&p.pendingRetries, -1)
+	p.taskLock.Lock()
+	p.notifyIdle()
+	p.taskLock.Unlock()
+}
+
+// fail counts a `CtxGoErr` task that failed for good and passes its error to
+// the error handler.
+func (p *pool) fail(ctx context.Context, err error) {
+	atomic.AddUint64(&p.stats.failed, 1)
+	if p.errorHandler != nil {
+		p.errorHandler(ctx, err)
+	}
+}
@@ -0,0 +1,128 @@
+package goroutine_pool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for attempt, want := range []time.Duration{10, 20, 40, 50, 50} {
+		if d := policy.backoff(attempt + 1); d != want*time.Millisecond {
+			t.Errorf("attempt %d: expected %v, got %v", attempt+1, want*time.Millisecond, d)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := policy.backoff(2); d < 10*time.Millisecond || d > 20*time.Millisecond {
+			t.Fatalf("jittered backoff %v out of [10ms, 20ms]", d)
+		}
+	}
+}
+
+func TestPoolRetry(t *testing.T) {
+	config := NewDefaultConfig()
+	config.RetryPolicy = &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	p := NewPool("retry", 2, config)
+	errs := make(chan error, 4)
+	p.SetErrorHandler(func(ctx context.Context, err error) { errs <- err })
+
+	// succeeds at the third attempt
+	var attempts int32
+	p.CtxGoErr(context.Background(), func(ctx context.Context) error {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+	// Wait waits for the pending retries
+	if err := p.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+	if s := p.Stats(); s.Retried != 2 || s.Failed != 0 || s.Completed != 3 {
+		t.Errorf("expected 2 retries, 0 failed and 3 completed, got %d, %d and %d", s.Retried, s.Failed, s.Completed)
+	}
+
+	// fails at every attempt
+	failure := errors.New("failure")
+	attempts = 0
+	p.CtxGoErr(context.Background(), func(ctx context.Context) error {
+		atomic.AddInt32(&attempts, 1)
+		return failure
+	})
+	_ = p.Wait(context.Background())
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+	if err := <-errs; err != failure {
+		t.Errorf("expected the error of the last attempt, got %v", err)
+	}
+	if s := p.Stats(); s.Retried != 4 || s.Failed != 1 {
+		t.Errorf("expected 4 retries and 1 failed, got %d and %d", s.Retried, s.Failed)
+	}
+
+	// not retryable, and the retries disabled by the context
+	permanent := errors.New("permanent")
+	ctx := WithRetryPolicy(context.Background(), &RetryPolicy{
+		MaxAttempts: 3,
+		Retryable:   func(err error) bool { return err != permanent },
+	})
+	p.CtxGoErr(ctx, func(ctx context.Context) error { return permanent })
+	p.CtxGoErr(WithRetryPolicy(context.Background(), nil), func(ctx context.Context) error { return failure })
+	_ = p.Wait(context.Background())
+	if s := p.Stats(); s.Retried != 4 || s.Failed != 3 {
+		t.Errorf("expected 4 retries and 3 failed, got %d and %d", s.Retried, s.Failed)
+	}
+}
+
+func TestPoolRetryDeadline(t *testing.T) {
+	p := NewPool("retry", 1, NewDefaultConfig())
+	ctx := WithRetryPolicy(context.Background(), &RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: 10 * time.Millisecond,
+		Deadline:       25 * time.Millisecond,
+	})
+	var attempts int32
+	p.CtxGoErr(ctx, func(ctx context.Context) error {
+		atomic.AddInt32(&attempts, 1)
+		return errors.New("failure")
+	})
+	_ = p.Wait(context.Background())
+	// retries after 10ms and 10+20ms, the next one would start after the deadline
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestPoolRetryShutdown(t *testing.T) {
+	p := NewPool("retry", 1, NewDefaultConfig())
+	errs := make(chan error, 1)
+	p.SetErrorHandler(func(ctx context.Context, err error) { errs <- err })
+
+	failure := errors.New("failure")
+	ctx := WithRetryPolicy(context.Background(), &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Hour})
+	p.CtxGoErr(ctx, func(ctx context.Context) error { return failure })
+
+	waitCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Wait(waitCtx); err != context.DeadlineExceeded {
+		t.Fatalf("Wait returned %v with a pending retry", err)
+	}
+	// the pending retry is dropped and the task fails
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != failure {
+		t.Errorf("expected %v, got %v", failure, err)
+	}
+	if s := p.Stats(); s.Retried != 1 || s.Failed != 1 {
+		t.Errorf("expected 1 retry and 1 failed, got %d and %d", s.Retried, s.Failed)
+	}
+}
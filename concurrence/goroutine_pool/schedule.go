@@ -0,0 +1,325 @@
+package goroutine_pool
+
+import (
+	"container/heap"
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kisunSea/gopkg/logging"
+)
+
+// scheduled tasks ...
+//
+// The delayed and periodic tasks of a pool wait in a single timer heap, served
+// by one goroutine that exists only while the heap is not empty. When a task
+// is due it is submitted to the pool like a `Go` task, a periodic task is
+// rescheduled at the same time. The goroutine never waits for a queue slot nor
+// runs a task, whatever `QueueFullPolicy`: an occurrence due while the task
+// list is full is skipped, a retry is rescheduled after its backoff.
+
+// ScheduleOptions controls the periodic tasks, see `GoEveryWithOptions` and
+// `GoCron`. A nil *ScheduleOptions runs every occurrence on time.
+type ScheduleOptions struct {
+	// Jitter delays each occurrence by a random duration in [0, Jitter), so
+	// that the tasks of many processes do not start at the same instant
+	Jitter time.Duration
+	// SkipIfRunning skips an occurrence if the previous one is still queued or running
+	SkipIfRunning bool
+	// Location of the cron expressions, `time.Local` by default
+	Location *time.Location
+}
+
+// Scheduled is the handle of a delayed or periodic task.
+type Scheduled struct {
+	pool *pool
+	f    func()
+	opts ScheduleOptions
+
+	// at is the time of the next occurrence, when is `at` plus the jitter
+	at, when time.Time
+	every    time.Duration
+	cron     *cronSchedule
+
+	// index in the heap, -1 when not scheduled, index and cancelled are
+	// guarded by `scheduler.mu`
+	index     int
+	cancelled bool
+	// submit replaces the submission of f, and onStop is called if the task
+	// is dropped by `Pool.Close`, see `pool.retry`
+	submit  func()
+	onStop  func()
+	running int32 // 1 while an occurrence is queued or running, see `SkipIfRunning`
+}
+
+// Cancel stops the next occurrences of the task, an occurrence already
+// submitted to the pool still runs. It returns false if there was no
+// occurrence left, i.e. a delayed task that was already submitted or a task
+// already cancelled.
+func (s *Scheduled) Cancel() bool {
+	sc := &s.pool.sched
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if s.cancelled {
+		return false
+	}
+	s.cancelled = true
+	if s.index < 0 {
+		return false
+	}
+	heap.Remove(&sc.entries, s.index)
+	return true
+}
+
+// Next returns the time of the next occurrence, or the zero time if there is none.
+func (s *Scheduled) Next() time.Time {
+	s.pool.sched.mu.Lock()
+	defer s.pool.sched.mu.Unlock()
+	if s.index < 0 {
+		return time.Time{}
+	}
+	return s.at
+}
+
+type scheduleHeap []*Scheduled
+
+func (h scheduleHeap) Len() int           { return len(h) }
+func (h scheduleHeap) Less(i, j int) bool { return h[i].when.Before(h[j].when) }
+func (h scheduleHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *scheduleHeap) Push(x interface{}) {
+	s := x.(*Scheduled)
+	s.index = len(*h)
+	*h = append(*h, s)
+}
+
+func (h *scheduleHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	s := old[n-1]
+	old[n-1] = nil
+	s.index = -1
+	*h = old[:n-1]
+	return s
+}
+
+type scheduler struct {
+	mu      sync.Mutex
+	entries scheduleHeap
+	running bool          // the goroutine serving the heap is running
+	wake    chan struct{} // signals a new head of the heap
+	closed  bool
+}
+
+// add schedules `s` at `s.at`, it must be called with `mu` held.
+func (sc *scheduler) add(p *pool, s *Scheduled) {
+	s.when = s.at
+	if s.opts.Jitter > 0 {
+		s.when = s.when.Add(time.Duration(rand.Int63n(int64(s.opts.Jitter))))
+	}
+	heap.Push(&sc.entries, s)
+	if !sc.running {
+		sc.running = true
+		go p.runScheduler()
+	} else if s.index == 0 {
+		select {
+		case sc.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// stop drops the scheduled tasks, the tasks scheduled later are rejected.
+func (sc *scheduler) stop() {
+	sc.mu.Lock()
+	sc.closed = true
+	var stopped []func()
+	for _, s := range sc.entries {
+		s.index = -1
+		if s.onStop != nil {
+			stopped = append(stopped, s.onStop)
+		}
+	}
+	sc.entries = nil
+	select {
+	case sc.wake <- struct{}{}:
+	default:
+	}
+	sc.mu.Unlock()
+
+	for _, onStop := range stopped {
+		onStop()
+	}
+}
+
+func (p *pool) GoAfter(d time.Duration, f func()) *Scheduled {
+	return p.schedule(&Scheduled{f: f, at: time.Now().Add(d)})
+}
+
+func (p *pool) GoAt(t time.Time, f func()) *Scheduled {
+	return p.schedule(&Scheduled{f: f, at: t})
+}
+
+func (p *pool) GoEvery(interval time.Duration, f func()) *Scheduled {
+	return p.GoEveryWithOptions(interval, nil, f)
+}
+
+func (p *pool) GoEveryWithOptions(interval time.Duration, opts *ScheduleOptions, f func()) *Scheduled {
+	if interval <= 0 {
+		panic("goroutine_pool: non-positive interval for GoEvery")
+	}
+	s := &Scheduled{f: f, at: time.Now().Add(interval), every: interval}
+	if opts != nil {
+		s.opts = *opts
+	}
+	return p.schedule(s)
+}
+
+func (p *pool) GoCron(spec string, opts *ScheduleOptions, f func()) (*Scheduled, error) {
+	s := &Scheduled{f: f}
+	if opts != nil {
+		s.opts = *opts
+	}
+	cron, err := parseCron(spec, s.opts.Location)
+	if err != nil {
+		return nil, err
+	}
+	s.cron = cron
+	s.at = cron.next(time.Now())
+	return p.schedule(s), nil
+}
+
+func (p *pool) schedule(s *Scheduled) *Scheduled {
+	s.pool = p
+	s.index = -1
+	if s.cron != nil && s.at.IsZero() {
+		// the expression never matches
+		return s
+	}
+
+	p.sched.mu.Lock()
+	defer p.sched.mu.Unlock()
+	if p.sched.closed {
+		logger.WarnT("GOPOOL: task rejected", logging.String("pool", p.name), logging.Err(ErrPoolClosed))
+		return s
+	}
+	p.sched.add(p, s)
+	return s
+}
+
+// runScheduler submits the scheduled tasks when they are due, it returns once
+// the heap is empty.
+func (p *pool) runScheduler() {
+	sc := &p.sched
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	var due []*Scheduled
+	for {
+		sc.mu.Lock()
+		now := time.Now()
+		due = due[:0]
+		for len(sc.entries) > 0 && !sc.entries[0].when.After(now) {
+			s := heap.Pop(&sc.entries).(*Scheduled)
+			due = append(due, s)
+			// not cancelled, otherwise it would not be in the heap
+			if next := s.next(now); !next.IsZero() {
+				s.at = next
+				sc.add(p, s)
+			}
+		}
+		if len(due) == 0 && len(sc.entries) == 0 {
+			sc.running = false
+			sc.mu.Unlock()
+			return
+		}
+		var wait time.Duration
+		if len(due) == 0 {
+			wait = sc.entries[0].when.Sub(now)
+		}
+		sc.mu.Unlock()
+
+		if len(due) > 0 {
+			for i, s := range due {
+				p.fire(s)
+				due[i] = nil
+			}
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-sc.wake:
+		}
+	}
+}
+
+// next returns the time of the occurrence after `now`, or the zero time for a
+// delayed task. Missed occurrences are skipped.
+func (s *Scheduled) next(now time.Time) time.Time {
+	switch {
+	case s.every > 0:
+		next := s.at.Add(s.every)
+		if !next.After(now) {
+			next = next.Add((now.Sub(next)/s.every + 1) * s.every)
+		}
+		return next
+	case s.cron != nil:
+		return s.cron.next(now)
+	}
+	return time.Time{}
+}
+
+// fire submits an occurrence of `s` to the pool, or skips it if the task list
+// is full.
+func (p *pool) fire(s *Scheduled) {
+	if s.submit != nil {
+		s.submit()
+		return
+	}
+	t := newPoolTask(context.Background())
+	t.f = s.f
+	if s.opts.SkipIfRunning {
+		if !atomic.CompareAndSwapInt32(&s.running, 0, 1) {
+			t.Recycle()
+			return
+		}
+		t.f = func() {
+			defer atomic.StoreInt32(&s.running, 0)
+			s.f()
+		}
+		t.onCancel = func(error) { atomic.StoreInt32(&s.running, 0) }
+	}
+	if err := p.offer(t); err != nil {
+		if s.opts.SkipIfRunning {
+			atomic.StoreInt32(&s.running, 0)
+		}
+		atomic.AddUint64(&p.stats.rejected, 1)
+		logger.WarnT("GOPOOL: scheduled task skipped", logging.String("pool", p.name), logging.Err(err))
+	}
+}
+
+// reschedule adds `s` back to the heap after `d`, it returns false if the
+// pool was closed.
+func (p *pool) reschedule(s *Scheduled, d time.Duration) bool {
+	p.sched.mu.Lock()
+	defer p.sched.mu.Unlock()
+	if p.sched.closed {
+		return false
+	}
+	s.at = time.Now().Add(d)
+	p.sched.add(p, s)
+	return true
+}
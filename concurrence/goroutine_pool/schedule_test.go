@@ -0,0 +1,197 @@
+package goroutine_pool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGoAfter(t *testing.T) {
+	p := NewPool("schedule", 4, NewDefaultConfig())
+
+	start := time.Now()
+	done := make(chan time.Time, 1)
+	p.GoAfter(30*time.Millisecond, func() { done <- time.Now() })
+	var n int32
+	cancelled := p.GoAt(start.Add(20*time.Millisecond), func() { atomic.AddInt32(&n, 1) })
+	if !cancelled.Cancel() {
+		t.Error("Cancel of a pending task returned false")
+	}
+	if cancelled.Cancel() {
+		t.Error("second Cancel returned true")
+	}
+
+	select {
+	case at := <-done:
+		if at.Sub(start) < 30*time.Millisecond {
+			t.Errorf("task run after %v", at.Sub(start))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("delayed task not run")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n != 0 {
+		t.Error("cancelled task run")
+	}
+	// the scheduler goroutine leaves once the heap is empty
+	sc := &p.(*pool).sched
+	sc.mu.Lock()
+	running := sc.running
+	sc.mu.Unlock()
+	if running {
+		t.Error("scheduler still running with an empty heap")
+	}
+}
+
+func TestGoEvery(t *testing.T) {
+	p := NewPool("schedule", 4, NewDefaultConfig())
+
+	var n int32
+	s := p.GoEvery(10*time.Millisecond, func() { atomic.AddInt32(&n, 1) })
+	time.Sleep(105 * time.Millisecond)
+	if !s.Cancel() {
+		t.Error("Cancel of a periodic task returned false")
+	}
+	got := atomic.LoadInt32(&n)
+	if got < 5 || got > 11 {
+		t.Errorf("%d runs in 105ms every 10ms", got)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if after := atomic.LoadInt32(&n); after > got+1 {
+		t.Errorf("%d runs after Cancel", after-got)
+	}
+	if !s.Next().IsZero() {
+		t.Error("cancelled task has a next occurrence")
+	}
+
+	// a periodic task stops when the pool is closed
+	var m int32
+	p.GoEvery(5*time.Millisecond, func() { atomic.AddInt32(&m, 1) })
+	time.Sleep(20 * time.Millisecond)
+	p.Close()
+	got = atomic.LoadInt32(&m)
+	time.Sleep(20 * time.Millisecond)
+	if after := atomic.LoadInt32(&m); after > got+1 {
+		t.Errorf("%d runs after Close", after-got)
+	}
+}
+
+func TestGoEverySkipIfRunning(t *testing.T) {
+	p := NewPool("schedule", 4, NewDefaultConfig())
+
+	var running, overlaps, n int32
+	s := p.GoEveryWithOptions(5*time.Millisecond, &ScheduleOptions{SkipIfRunning: true, Jitter: time.Millisecond}, func() {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		atomic.AddInt32(&n, 1)
+		time.Sleep(22 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	})
+	time.Sleep(100 * time.Millisecond)
+	s.Cancel()
+	if overlaps != 0 {
+		t.Errorf("%d overlapping runs", overlaps)
+	}
+	if got := atomic.LoadInt32(&n); got < 2 || got > 5 {
+		t.Errorf("%d runs of a 22ms task in 100ms", got)
+	}
+}
+
+func TestScheduleQueueFull(t *testing.T) {
+	for _, policy := range []QueueFullPolicy{PolicyBlock, PolicyCallerRuns} {
+		config := NewDefaultConfig()
+		config.MaxQueueLen = 1
+		config.QueueFullPolicy = policy
+		config.RetryPolicy = &RetryPolicy{MaxAttempts: 2, InitialBackoff: 30 * time.Millisecond}
+		p := NewPool("schedule", 1, config)
+
+		var attempts int32
+		p.CtxGoErr(context.Background(), func(ctx context.Context) error {
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				return errors.New("transient")
+			}
+			return nil
+		})
+		for p.Stats().Retried == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		// the only worker is busy and the task list full when the timers fire
+		started, release := make(chan struct{}), make(chan struct{})
+		p.Go(func() { close(started); <-release })
+		<-started
+		p.Go(func() {})
+
+		// the scheduler neither blocks nor runs the task, the occurrence is
+		// skipped and the retry waits for the task list to drain
+		var n int32
+		p.GoAfter(time.Millisecond, func() { atomic.AddInt32(&n, 1) })
+		time.Sleep(60 * time.Millisecond)
+		if r := p.Stats().Rejected; r != 1 {
+			t.Errorf("policy %d: %d tasks rejected, want 1", policy, r)
+		}
+		close(release)
+		if err := p.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if atomic.LoadInt32(&n) != 0 {
+			t.Errorf("policy %d: scheduled task run with a full task list", policy)
+		}
+		if s := p.Stats(); attempts != 2 || s.Failed != 0 {
+			t.Errorf("policy %d: expected 2 attempts and 0 failed, got %d and %d", policy, attempts, s.Failed)
+		}
+	}
+}
+
+func TestCron(t *testing.T) {
+	utc := time.UTC
+	base := time.Date(2021, 3, 15, 10, 7, 30, 0, utc) // a monday
+	for _, tc := range []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2021, 3, 15, 10, 8, 0, 0, utc)},
+		{"*/15 * * * *", time.Date(2021, 3, 15, 10, 15, 0, 0, utc)},
+		{"0 9-17 * * *", time.Date(2021, 3, 15, 11, 0, 0, 0, utc)},
+		{"30 8 * * mon-fri", time.Date(2021, 3, 16, 8, 30, 0, 0, utc)},
+		{"0 0 * * 7", time.Date(2021, 3, 21, 0, 0, 0, 0, utc)},
+		{"0 0 1,15 * *", time.Date(2021, 4, 1, 0, 0, 0, 0, utc)},
+		// day of month or day of week
+		{"0 0 20 * fri", time.Date(2021, 3, 19, 0, 0, 0, 0, utc)},
+		{"0 12 29 feb *", time.Date(2024, 2, 29, 12, 0, 0, 0, utc)},
+		{"5/20 * * * *", time.Date(2021, 3, 15, 10, 25, 0, 0, utc)},
+		{"@daily", time.Date(2021, 3, 16, 0, 0, 0, 0, utc)},
+		{"@monthly", time.Date(2021, 4, 1, 0, 0, 0, 0, utc)},
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		c, err := parseCron(tc.spec, utc)
+		if err != nil {
+			t.Errorf("%s: %v", tc.spec, err)
+			continue
+		}
+		if next := c.next(base); !next.Equal(tc.next) {
+			t.Errorf("%s: expected %v, got %v", tc.spec, tc.next, next)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := parseCron(spec, utc); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+
+	p := NewPool("schedule", 1, NewDefaultConfig())
+	if _, err := p.GoCron("* * *", nil, func() {}); err == nil {
+		t.Error("GoCron accepted an invalid expression")
+	}
+	s, err := p.GoCron("@hourly", &ScheduleOptions{Location: utc}, func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := s.Next(); next.Minute() != 0 || !next.After(time.Now()) {
+		t.Errorf("unexpected next occurrence %v", next)
+	}
+	s.Cancel()
+}
@@ -0,0 +1,283 @@
+package goroutine_pool
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// upper bounds of the histogram buckets, in seconds
+var _histogramBounds = [...]float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}
+
+// histogram is a lock-free latency histogram with the buckets of `_histogramBounds`.
+type histogram struct {
+	counts [len(_histogramBounds) + 1]uint64 // the last bucket is +Inf
+	count  uint64
+	sum    int64 // nanoseconds
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := len(_histogramBounds)
+	for j, bound := range _histogramBounds {
+		if d.Seconds() <= bound {
+			i = j
+			break
+		}
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	s := Histogram{
+		Bounds: _histogramBounds[:],
+		Counts: make([]uint64, len(h.counts)),
+		Count:  atomic.LoadUint64(&h.count),
+		Sum:    time.Duration(atomic.LoadInt64(&h.sum)),
+	}
+	for i := range h.counts {
+		s.Counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	return s
+}
+
+// Histogram is a snapshot of a latency histogram.
+type Histogram struct {
+	// Bounds are the upper bounds of the buckets in seconds, the last bucket has no bound
+	Bounds []float64
+	// Counts are the number of observations in each bucket, they are not cumulative
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+// counters of a pool, updated atomically
+type poolStats struct {
+	running   int32
+	completed uint64
+	panicked  uint64
+	rejected  uint64
+	cancelled uint64
+	failed    uint64
+	retried   uint64
+	// changes of capacity by the autoscaler
+	scaleUps   uint64
+	scaleDowns uint64
+	queueWait  histogram
+	runTime    histogram
+	rateWait   histogram
+}
+
+// Stats is a snapshot of the state and the counters of a pool.
+type Stats struct {
+	Name     string
+	Capacity int32
+	Workers  int32
+	// Queued is the number of tasks waiting for a worker, QueuedByPriority
+	// breaks it down by priority name
+	Queued           int32
+	QueuedByPriority map[string]int32
+	// Running is the number of tasks being run
+	Running int32
+	// Completed is the number of tasks that returned, Panicked the number of
+	// tasks that panicked
+	Completed uint64
+	Panicked  uint64
+	// Rejected is the number of tasks rejected or discarded, see `TryGo`
+	Rejected uint64
+	// Cancelled is the number of tasks skipped because their context was done
+	Cancelled uint64
+	// Failed is the number of `CtxGoErr` tasks whose last attempt returned
+	// an error, Retried the number of retries, see `RetryPolicy`. Every
+	// attempt is counted in Completed
+	Failed  uint64
+	Retried uint64
+	// ScaleUps and ScaleDowns are the changes of capacity made by the
+	// autoscaler, LastScale is the last of them, see `Config.Autoscale`
+	ScaleUps   uint64
+	ScaleDowns uint64
+	LastScale  *AutoscaleEvent `json:",omitempty"`
+	// QueueWait is the time spent by the tasks in the task list, RunTime the
+	// time spent running them
+	QueueWait Histogram
+	RunTime   Histogram
+	// RateWait is the time spent by the workers waiting for the rate limit
+	// before starting a task, see `Config.RateLimit`
+	RateWait Histogram
+}
+
+func (p *pool) Stats() Stats {
+	s := Stats{
+		Name:             p.name,
+		Capacity:         p.Capacity(),
+		Workers:          p.WorkerCount(),
+		QueuedByPriority: make(map[string]int32, priorityLevels),
+		Running:          atomic.LoadInt32(&p.stats.running),
+		Completed:        atomic.LoadUint64(&p.stats.completed),
+		Panicked:         atomic.LoadUint64(&p.stats.panicked),
+		Rejected:         atomic.LoadUint64(&p.stats.rejected),
+		Cancelled:        atomic.LoadUint64(&p.stats.cancelled),
+		Failed:           atomic.LoadUint64(&p.stats.failed),
+		Retried:          atomic.LoadUint64(&p.stats.retried),
+		ScaleUps:         atomic.LoadUint64(&p.stats.scaleUps),
+		ScaleDowns:       atomic.LoadUint64(&p.stats.scaleDowns),
+		QueueWait:        p.stats.queueWait.snapshot(),
+		RunTime:          p.stats.runTime.snapshot(),
+		RateWait:         p.stats.rateWait.snapshot(),
+	}
+	if event, ok := p.lastScale.Load().(AutoscaleEvent); ok {
+		s.LastScale = &event
+	}
+	for prio := PriorityLow; prio <= PriorityHigh; prio++ {
+		n := p.QueueLen(prio)
+		s.QueuedByPriority[prio.String()] = n
+		s.Queued += n
+	}
+	return s
+}
+
+var _registry struct {
+	sync.Mutex
+	pools []*pool
+}
+
+func registerPool(p *pool) {
+	_registry.Lock()
+	defer _registry.Unlock()
+	_registry.pools = append(_registry.pools, p)
+}
+
+func unregisterPool(p *pool) {
+	_registry.Lock()
+	defer _registry.Unlock()
+	for i, registered := range _registry.pools {
+		if registered == p {
+			_registry.pools = append(_registry.pools[:i], _registry.pools[i+1:]...)
+			return
+		}
+	}
+}
+
+// AllStats returns the snapshots of all the pools created by `NewPool`, a
+// pool leaves the registry once it is closed and idle.
+func AllStats() []Stats {
+	_registry.Lock()
+	pools := append([]*pool(nil), _registry.pools...)
+	_registry.Unlock()
+
+	stats := make([]Stats, 0, len(pools))
+	for _, p := range pools {
+		stats = append(stats, p.Stats())
+	}
+	return stats
+}
+
+// StatsHandler returns a `http.Handler` that serves `AllStats()` as JSON.
+func StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(AllStats())
+	})
+}
+
+// MetricsHandler returns a `http.Handler` that serves `AllStats()` in the
+// Prometheus text exposition format.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = WritePrometheus(w)
+	})
+}
+
+// WritePrometheus writes `AllStats()` to `w` in the Prometheus text exposition format.
+func WritePrometheus(w io.Writer) error {
+	stats := AllStats()
+
+	// pools may share a name, keep their series apart
+	seen := make(map[string]int)
+	for i := range stats {
+		name := stats[i].Name
+		if seen[name]++; seen[name] > 1 {
+			stats[i].Name = fmt.Sprintf("%s#%d", name, seen[name])
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	metric := func(name, typ, help string, value func(s *Stats) string) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for i := range stats {
+			fmt.Fprintf(bw, "%s{%s} %s\n", name, poolLabel(&stats[i]), value(&stats[i]))
+		}
+	}
+	gauge := func(name, help string, value func(s *Stats) int32) {
+		metric(name, "gauge", help, func(s *Stats) string { return strconv.Itoa(int(value(s))) })
+	}
+	counter := func(name, help string, value func(s *Stats) uint64) {
+		metric(name, "counter", help, func(s *Stats) string { return strconv.FormatUint(value(s), 10) })
+	}
+	histo := func(name, help string, value func(s *Stats) *Histogram) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+		for i := range stats {
+			h, label := value(&stats[i]), poolLabel(&stats[i])
+			var cumulative uint64
+			for j, n := range h.Counts {
+				cumulative += n
+				le := "+Inf"
+				if j < len(h.Bounds) {
+					le = strconv.FormatFloat(h.Bounds[j], 'g', -1, 64)
+				}
+				fmt.Fprintf(bw, "%s_bucket{%s,le=\"%s\"} %d\n", name, label, le, cumulative)
+			}
+			fmt.Fprintf(bw, "%s_sum{%s} %s\n", name, label, strconv.FormatFloat(h.Sum.Seconds(), 'g', -1, 64))
+			fmt.Fprintf(bw, "%s_count{%s} %d\n", name, label, h.Count)
+		}
+	}
+
+	gauge("gopkg_pool_capacity", "Maximum number of workers of the pool.", func(s *Stats) int32 { return s.Capacity })
+	gauge("gopkg_pool_workers", "Number of workers of the pool.", func(s *Stats) int32 { return s.Workers })
+	fmt.Fprintf(bw, "# HELP gopkg_pool_queued_tasks Tasks waiting for a worker, by priority.\n"+
+		"# TYPE gopkg_pool_queued_tasks gauge\n")
+	for i := range stats {
+		for prio := PriorityLow; prio <= PriorityHigh; prio++ {
+			fmt.Fprintf(bw, "gopkg_pool_queued_tasks{%s,priority=\"%s\"} %d\n",
+				poolLabel(&stats[i]), prio, stats[i].QueuedByPriority[prio.String()])
+		}
+	}
+	gauge("gopkg_pool_running_tasks", "Tasks being run.", func(s *Stats) int32 { return s.Running })
+	counter("gopkg_pool_completed_tasks_total", "Tasks that returned.", func(s *Stats) uint64 { return s.Completed })
+	counter("gopkg_pool_panicked_tasks_total", "Tasks that panicked.", func(s *Stats) uint64 { return s.Panicked })
+	counter("gopkg_pool_rejected_tasks_total", "Tasks rejected or discarded.", func(s *Stats) uint64 { return s.Rejected })
+	counter("gopkg_pool_cancelled_tasks_total", "Tasks skipped because their context was done.",
+		func(s *Stats) uint64 { return s.Cancelled })
+	counter("gopkg_pool_failed_tasks_total", "Tasks that returned an error.", func(s *Stats) uint64 { return s.Failed })
+	counter("gopkg_pool_retried_tasks_total", "Retries of the tasks that returned an error.",
+		func(s *Stats) uint64 { return s.Retried })
+	counter("gopkg_pool_scale_ups_total", "Capacity increases made by the autoscaler.",
+		func(s *Stats) uint64 { return s.ScaleUps })
+	counter("gopkg_pool_scale_downs_total", "Capacity decreases made by the autoscaler.",
+		func(s *Stats) uint64 { return s.ScaleDowns })
+	histo("gopkg_pool_queue_wait_seconds", "Time spent by the tasks in the task list.",
+		func(s *Stats) *Histogram { return &s.QueueWait })
+	histo("gopkg_pool_run_time_seconds", "Time spent running the tasks.",
+		func(s *Stats) *Histogram { return &s.RunTime })
+	histo("gopkg_pool_rate_wait_seconds", "Time spent waiting for the rate limit before starting the tasks.",
+		func(s *Stats) *Histogram { return &s.RateWait })
+
+	return bw.Flush()
+}
+
+var _labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func poolLabel(s *Stats) string {
+	return `pool="` + _labelEscaper.Replace(s.Name) + `"`
+}
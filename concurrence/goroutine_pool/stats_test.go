@@ -0,0 +1,98 @@
+package goroutine_pool
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPoolStats(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MaxQueueLen = 1
+	config.QueueFullPolicy = PolicyReject
+	p := NewPool("stats", 1, config)
+
+	release, started := make(chan struct{}), make(chan struct{})
+	p.Go(func() { close(started); <-release })
+	<-started
+	p.CtxGoPriority(context.Background(), PriorityHigh, func() { time.Sleep(time.Millisecond) })
+	if err := p.TryGo(func() {}); err != ErrPoolFull {
+		t.Fatalf("expected ErrPoolFull, got %v", err)
+	}
+
+	s := p.Stats()
+	if s.Name != "stats" || s.Capacity != 1 || s.Workers != 1 || s.Running != 1 {
+		t.Errorf("unexpected state %+v", s)
+	}
+	if s.Queued != 1 || s.QueuedByPriority["high"] != 1 || s.QueuedByPriority["normal"] != 0 {
+		t.Errorf("unexpected queue lengths %d %v", s.Queued, s.QueuedByPriority)
+	}
+	if s.Rejected != 1 {
+		t.Errorf("expected 1 rejected task, got %d", s.Rejected)
+	}
+
+	close(release)
+	_ = p.Wait(context.Background())
+	p.Go(func() { panic("boom") })
+	_ = p.Wait(context.Background())
+
+	s = p.Stats()
+	if s.Running != 0 || s.Queued != 0 || s.Completed != 2 || s.Panicked != 1 {
+		t.Errorf("unexpected counters %+v", s)
+	}
+	if s.QueueWait.Count != 3 || s.RunTime.Count != 3 || s.RunTime.Sum < time.Millisecond {
+		t.Errorf("unexpected histograms %+v %+v", s.QueueWait, s.RunTime)
+	}
+	var buckets uint64
+	for _, n := range s.RunTime.Counts {
+		buckets += n
+	}
+	if buckets != s.RunTime.Count || len(s.RunTime.Counts) != len(s.RunTime.Bounds)+1 {
+		t.Errorf("unexpected buckets %+v", s.RunTime)
+	}
+}
+
+func TestStatsHandlers(t *testing.T) {
+	p := NewPool("handlers", 2, NewDefaultConfig())
+	p.Go(func() {})
+	_ = p.Wait(context.Background())
+
+	rec := httptest.NewRecorder()
+	StatsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/pools", nil))
+	var stats []Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, s := range stats {
+		found = found || (s.Name == "handlers" && s.Completed == 1)
+	}
+	if !found {
+		t.Errorf("pool not found in %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		"# TYPE gopkg_pool_completed_tasks_total counter",
+		`gopkg_pool_completed_tasks_total{pool="handlers"} 1`,
+		`gopkg_pool_queued_tasks{pool="handlers",priority="high"} 0`,
+		`gopkg_pool_run_time_seconds_bucket{pool="handlers",le="+Inf"} 1`,
+		`gopkg_pool_queue_wait_seconds_count{pool="handlers"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("%q not found", want)
+		}
+	}
+
+	// a closed and idle pool leaves the registry
+	_ = p.Shutdown(context.Background())
+	for _, s := range AllStats() {
+		if s.Name == "handlers" {
+			t.Error("closed pool still registered")
+		}
+	}
+}
@@ -3,12 +3,19 @@ package goroutine_pool
 import (
 	"context"
 	"sync"
+	"time"
 )
 
 type task struct {
-	ctx  context.Context
-	f    func()
-	next *task
+	ctx      context.Context
+	f        func()
+	fe       func(context.Context) error // the task if it was submitted by `CtxGoErr`
+	onCancel func(error)                 // called if the task is skipped, see `pool.runTask`
+	attempt  int                         // the number of failed attempts, see `RetryPolicy`
+	firstRun time.Time                   // the start of the first attempt
+	priority Priority
+	enqueued time.Time
+	next     *task
 }
 
 // 全局的任务对象池
@@ -17,6 +24,12 @@ var taskPool = sync.Pool{New: newTask}
 func (t *task) zero() {
 	t.ctx = nil
 	t.f = nil
+	t.fe = nil
+	t.onCancel = nil
+	t.attempt = 0
+	t.firstRun = time.Time{}
+	t.priority = PriorityNormal
+	t.enqueued = time.Time{}
 	t.next = nil
 }
 
@@ -25,6 +38,28 @@ func (t *task) Recycle() {
 	taskPool.Put(t)
 }
 
+// newPoolTask returns a recycled task for `ctx`.
+func newPoolTask(ctx context.Context) *task {
+	t := taskPool.Get().(*task)
+	t.ctx = ctx
+	t.priority = priorityOf(ctx)
+	return t
+}
+
+type taskTimeoutCtxKey struct{}
+
+// WithTaskTimeout returns a copy of `ctx` carrying a task timeout, the
+// `CtxGoErr` tasks submitted with the returned context get a context that
+// expires `timeout` after they start. It overrides `Config.TaskTimeout`.
+func WithTaskTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, taskTimeoutCtxKey{}, timeout)
+}
+
+func taskTimeoutOf(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(taskTimeoutCtxKey{}).(time.Duration)
+	return timeout, ok
+}
+
 func newTask() interface{} {
 	return &task{}
 }
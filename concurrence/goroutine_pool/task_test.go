@@ -0,0 +1,74 @@
+package goroutine_pool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolSkipsCancelledTasks(t *testing.T) {
+	p := NewPool("cancelled", 1, NewDefaultConfig())
+	var (
+		cancelled = make(chan error, 2)
+		ran       int32
+	)
+	p.SetCancelHandler(func(ctx context.Context, err error) { cancelled <- err })
+
+	release, started := make(chan struct{}), make(chan struct{})
+	p.Go(func() { close(started); <-release })
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.CtxGo(ctx, func() { atomic.StoreInt32(&ran, 1) })
+	future := p.CtxSubmit(ctx, func() (interface{}, error) { return nil, nil })
+	cancel()
+	close(release)
+	_ = p.Wait(context.Background())
+
+	if atomic.LoadInt32(&ran) != 0 {
+		t.Error("cancelled task ran")
+	}
+	if err := <-cancelled; err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if _, err := future.Get(context.Background()); err != context.Canceled {
+		t.Errorf("expected the future to fail with context.Canceled, got %v", err)
+	}
+	if s := p.Stats(); s.Cancelled != 2 || s.Completed != 1 {
+		t.Errorf("expected 2 cancelled and 1 completed tasks, got %d and %d", s.Cancelled, s.Completed)
+	}
+}
+
+func TestPoolErrorTasks(t *testing.T) {
+	config := NewDefaultConfig()
+	config.TaskTimeout = time.Hour
+	p := NewPool("errors", 2, config)
+
+	errs := make(chan error, 2)
+	p.SetErrorHandler(func(ctx context.Context, err error) { errs <- err })
+
+	failure := errors.New("failure")
+	p.CtxGoErr(context.Background(), func(ctx context.Context) error { return failure })
+	p.CtxGoErr(context.Background(), func(ctx context.Context) error { return nil })
+	// the context value overrides Config.TaskTimeout
+	p.CtxGoErr(WithTaskTimeout(context.Background(), 10*time.Millisecond), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	_ = p.Wait(context.Background())
+	close(errs)
+
+	var got []error
+	for err := range errs {
+		got = append(got, err)
+	}
+	if len(got) != 2 || !(got[0] == failure || got[1] == failure) ||
+		!(got[0] == context.DeadlineExceeded || got[1] == context.DeadlineExceeded) {
+		t.Errorf("unexpected errors %v", got)
+	}
+	if s := p.Stats(); s.Failed != 2 || s.Completed != 3 {
+		t.Errorf("expected 2 failed and 3 completed tasks, got %d and %d", s.Failed, s.Completed)
+	}
+}
@@ -1,68 +1,154 @@
 package goroutine_pool
 
 import (
-	"fmt"
-	"github.com/kisunSea/gopkg/logging"
-	"runtime/debug"
 	"sync"
-	"sync/atomic"
+	"time"
+
+	"github.com/kisunSea/gopkg/logging"
 )
 
 var logger = logging.GLogger()
 
 type worker struct {
 	pool *pool
+	// home is the shard of the task queue the worker pops first, see `pool.popTask`
+	home uint32
+	// wake receives a signal when a task is queued for the parked worker
+	wake chan struct{}
 }
 
 // 全局的任务池
 var workerPool = sync.Pool{New: newWorker}
 
 func newWorker() interface{} {
-	return &worker{}
+	return &worker{wake: make(chan struct{}, 1)}
 }
 
 func (w *worker) run() {
 	go func() {
 		for {
-			var t *task
-			w.pool.taskLock.Lock()
-			if w.pool.taskHead != nil {
-				t = w.pool.taskHead
-				w.pool.taskHead = w.pool.taskHead.next
-				atomic.AddInt32(&w.pool.taskCount, -1)
+			// the rate limit is waited for before dequeuing, so that the
+			// queued tasks stay available to the other workers meanwhile
+			var (
+				waited   time.Duration
+				reserved bool
+			)
+			if w.pool.taskCount_() > 0 {
+				waited, reserved = w.pool.waitRate()
 			}
+			t := w.pool.popTask(w.home)
 			if t == nil {
-				w.close()
-				w.pool.taskLock.Unlock()
-				w.Recycle()
+				if reserved {
+					w.pool.limiter.refund()
+				}
+				switch w.rest() {
+				case workerRetry:
+					continue
+				case workerParked:
+					if w.park() {
+						continue
+					}
+				default:
+					w.Recycle()
+				}
 				return
 			}
-			w.pool.taskLock.Unlock()
-
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						msg := fmt.Sprintf("GOPOOL: panic in pool: %s: %v: %s", w.pool.name, r, debug.Stack())
-						logger.ErrorF("ctx->%v, err->%v", t.ctx, msg)
-						if w.pool.panicHandler != nil {
-							w.pool.panicHandler(t.ctx, r)
-						}
-					}
-				}()
-				fmt.Println(w.pool.taskCount)
-				t.f()
-			}()
+			w.pool.releaseSlot()
+			if reserved {
+				w.pool.stats.rateWait.observe(waited)
+			}
+
+			w.pool.runTask(t)
 			t.Recycle()
 		}
 	}()
 }
 
+const (
+	workerRetry = iota
+	workerParked
+	workerLeft
+)
+
+// rest parks the worker or makes it leave, after it found no task.
+//
+// `PutTask` does not take `taskLock`: it counts the task, and then looks for
+// a parked worker or starts one. So the worker first parks or leaves, and then
+// checks the count, if a task came in meanwhile it takes the task itself.
+func (w *worker) rest() int {
+	p := w.pool
+	p.taskLock.Lock()
+	defer p.taskLock.Unlock()
+	if p.keepAlive() {
+		p.parkWorker(w)
+		if p.taskCount_() > 0 && p.unparkWorker(w) {
+			return workerRetry
+		}
+		// if the worker was unparked by a submitter, the wake is on its way
+		return workerParked
+	}
+
+	w.close()
+	if p.taskCount_() > 0 {
+		p.incrWorkerCount()
+		return workerRetry
+	}
+	p.notifyIdle()
+	return workerLeft
+}
+
+// park waits for a task, it returns false if the worker left the pool after
+// `config.IdleTimeout`.
+func (w *worker) park() bool {
+	var timeout <-chan time.Time
+	if d := w.pool.config.IdleTimeout; d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-w.wake:
+		return true
+	case <-timeout:
+	}
+
+	p := w.pool
+	p.taskLock.Lock()
+	if !p.unparkWorker(w) {
+		// woken up at the same time
+		p.taskLock.Unlock()
+		<-w.wake
+		return true
+	}
+	if p.WorkerCount() <= p.config.MinWorkers && !p.isClosed() {
+		// a warm worker, see `config.MinWorkers`
+		p.taskLock.Unlock()
+		return true
+	}
+	w.close()
+	if p.taskCount_() > 0 {
+		// see `worker.rest`
+		p.incrWorkerCount()
+		p.taskLock.Unlock()
+		return true
+	}
+	p.notifyIdle()
+	p.taskLock.Unlock()
+	w.Recycle()
+	return false
+}
+
 func (w *worker) close() {
 	w.pool.decrWorkerCount()
 }
 
 func (w *worker) zero() {
 	w.pool = nil
+	select {
+	case <-w.wake:
+	default:
+	}
 }
 
 func (w *worker) Recycle() {
@@ -0,0 +1,516 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// audit ...
+//
+// Every entry written through an audit handler is wrapped in a record line:
+//
+//     <kind> <seq> <prev> <digest> <quoted entry>
+//
+// `kind` is `E` for log entries and `C` for checkpoints, `seq` increases by one
+// per record (across rotated files), `prev` is the digest of the previous record
+// and `digest` is HMAC-SHA256 (or plain SHA-256 when no key is given) over the
+// kind, seq, prev and the entry. Editing, removing or reordering any record
+// breaks the chain, which `VerifyAuditLog` reports.
+//
+// The first record of the oldest file is kept in `<path>.anchor`, as an `A`
+// record whose entry is the digest of the anchored record. The backups beyond
+// `MaxBackups` or `MaxAge` are removed by `auditSyncer` once the anchor moved
+// to the oldest file kept, so removing the oldest backup or the first records
+// of the chain is reported too.
+
+const (
+	auditKindEntry      = 'E'
+	auditKindCheckpoint = 'C'
+	auditKindAnchor     = 'A'
+
+	defaultAuditCheckpointEvery = 100
+
+	// lumberjack names backups `<name>-<time><ext>`
+	lumberjackBackupTimeFormat = "2006-01-02T15-04-05.000"
+)
+
+var auditGenesis = strings.Repeat("0", sha256.Size*2)
+
+// AuditError describes the first broken link found by `VerifyAuditLog`.
+type AuditError struct {
+	File   string
+	Line   int
+	Seq    uint64
+	Reason string
+}
+
+func (e *AuditError) Error() string {
+	return fmt.Sprintf("audit log broken at %s:%d (seq %d): %s", e.File, e.Line, e.Seq, e.Reason)
+}
+
+type auditRecord struct {
+	kind    byte
+	seq     uint64
+	prev    string
+	digest  string
+	payload string
+}
+
+func (r *auditRecord) marshal() []byte {
+	b := make([]byte, 0, len(r.payload)+160)
+	b = append(b, r.kind, ' ')
+	b = strconv.AppendUint(b, r.seq, 10)
+	b = append(b, ' ')
+	b = append(b, r.prev...)
+	b = append(b, ' ')
+	b = append(b, r.digest...)
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, r.payload)
+	return append(b, '\n')
+}
+
+func parseAuditRecord(line string) (r *auditRecord, err error) {
+	fields := strings.SplitN(line, " ", 5)
+	if len(fields) != 5 || len(fields[0]) != 1 {
+		return nil, fmt.Errorf("malformed record")
+	}
+	r = &auditRecord{kind: fields[0][0], prev: fields[2], digest: fields[3]}
+	if r.kind != auditKindEntry && r.kind != auditKindCheckpoint && r.kind != auditKindAnchor {
+		return nil, fmt.Errorf("unknown record kind `%c`", r.kind)
+	}
+	if r.seq, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+		return nil, fmt.Errorf("bad sequence number `%s`", fields[1])
+	}
+	if r.payload, err = strconv.Unquote(fields[4]); err != nil {
+		return nil, fmt.Errorf("bad record payload")
+	}
+	return r, nil
+}
+
+func auditDigest(key []byte, kind byte, seq uint64, prev, payload string) string {
+	var h hash.Hash
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	_, _ = fmt.Fprintf(h, "%c %d %s ", kind, seq, prev)
+	_, _ = h.Write([]byte(payload))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// auditSyncer chains every entry written by zap before handing it to `out`.
+type auditSyncer struct {
+	mu              sync.Mutex
+	out             zapcore.WriteSyncer
+	path            string
+	key             []byte
+	checkpointEvery int
+	maxBackups      int
+	maxAge          int
+	seq             uint64
+	prev            string
+	pending         int  // entries since the last checkpoint
+	anchored        bool // the anchor file exists
+}
+
+// newAuditSyncer resumes the chain from the newest record in `file` and its backups.
+// A record torn by a crash at the end of `file` is truncated, and a checkpoint
+// recording the recovery is appended, so that the chain resumes on a clean line.
+func newAuditSyncer(out zapcore.WriteSyncer, file string, a *auditWriter) (s *auditSyncer, err error) {
+	s = &auditSyncer{out: out, path: file, key: a.Key, checkpointEvery: a.CheckpointEvery,
+		maxBackups: a.MaxBackups, maxAge: a.MaxAge, prev: auditGenesis}
+	torn, err := truncateTornRecord(file)
+	if err != nil {
+		return nil, err
+	}
+	files, err := auditFiles(file)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		last, err := lastAuditRecord(files[i])
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			s.seq, s.prev = last.seq, last.digest
+			break
+		}
+	}
+
+	if _, err = os.Stat(auditAnchorPath(file)); err == nil {
+		s.anchored = true
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	} else if s.seq > 0 {
+		// a log written without anchor, it is anchored at its oldest record
+		if err = s.anchor(files); err != nil {
+			return nil, err
+		}
+	}
+
+	if torn > 0 {
+		if err = s.append(auditKindCheckpoint, fmt.Sprintf("recovered seq=%d torn=%d time=%s",
+			s.seq, torn, time.Now().Format(time.RFC3339Nano))); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// truncateTornRecord removes the bytes after the last newline of `file`, and
+// returns how many there were.
+func truncateTornRecord(file string) (torn int64, err error) {
+	fp, err := os.OpenFile(file, os.O_RDWR, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer fp.Close()
+
+	info, err := fp.Stat()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		size = info.Size()
+		end  = size
+		buf  = make([]byte, 64*1024)
+	)
+	for end > 0 {
+		n := int64(len(buf))
+		if n > end {
+			n = end
+		}
+		if _, err = fp.ReadAt(buf[:n], end-n); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			end = end - n + int64(i) + 1
+			break
+		}
+		end -= n
+	}
+	if end == size {
+		return 0, nil
+	}
+	return size - end, fp.Truncate(end)
+}
+
+func (s *auditSyncer) Write(p []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err = s.append(auditKindEntry, strings.TrimSuffix(string(p), "\n")); err != nil {
+		return 0, err
+	}
+	if s.pending++; s.checkpointEvery > 0 && s.pending >= s.checkpointEvery {
+		if err = s.checkpoint(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (s *auditSyncer) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.out.Sync()
+}
+
+func (s *auditSyncer) checkpoint() error {
+	s.pending = 0
+	return s.append(auditKindCheckpoint,
+		fmt.Sprintf("checkpoint seq=%d time=%s", s.seq, time.Now().Format(time.RFC3339Nano)))
+}
+
+func (s *auditSyncer) append(kind byte, payload string) error {
+	r := &auditRecord{kind: kind, seq: s.seq + 1, prev: s.prev, payload: payload}
+	r.digest = auditDigest(s.key, r.kind, r.seq, r.prev, r.payload)
+	if _, err := s.out.Write(r.marshal()); err != nil {
+		return err
+	}
+	s.seq, s.prev = r.seq, r.digest
+	if !s.anchored {
+		if err := writeAuditAnchor(s.path, s.key, r); err != nil {
+			return err
+		}
+		s.anchored = true
+	}
+	return nil
+}
+
+// rotated removes the backups beyond `maxBackups` and `maxAge`, after moving
+// the anchor to the oldest backup kept. It is called by the write that rotated
+// the file, with `mu` held. Like lumberjack, it gives up on errors until the
+// next rotation.
+func (s *auditSyncer) rotated() {
+	backups, err := auditBackups(s.path)
+	if err != nil {
+		return
+	}
+	keep := backups
+	if s.maxBackups > 0 && len(keep) > s.maxBackups {
+		keep = keep[len(keep)-s.maxBackups:]
+	}
+	if s.maxAge > 0 {
+		cutoff := time.Now().Add(-time.Duration(s.maxAge) * 24 * time.Hour)
+		for len(keep) > 0 && keep[0].time.Before(cutoff) {
+			keep = keep[1:]
+		}
+	}
+	if len(keep) == len(backups) {
+		return
+	}
+
+	files := make([]string, 0, len(keep)+1)
+	for _, b := range keep {
+		files = append(files, b.name)
+	}
+	// a crash between the two steps leaves old backups that verify skips
+	if err = s.anchor(append(files, s.path)); err != nil {
+		return
+	}
+	for _, b := range backups[:len(backups)-len(keep)] {
+		_ = os.Remove(b.name)
+	}
+}
+
+// anchor anchors the chain at the first record of `files`.
+func (s *auditSyncer) anchor(files []string) error {
+	for _, file := range files {
+		first, err := firstAuditRecord(file)
+		if err != nil {
+			return err
+		}
+		if first != nil {
+			if err = writeAuditAnchor(s.path, s.key, first); err != nil {
+				return err
+			}
+			s.anchored = true
+			return nil
+		}
+	}
+	return nil
+}
+
+func auditAnchorPath(path string) string {
+	return path + ".anchor"
+}
+
+// writeAuditAnchor replaces the anchor of `path` by `first`.
+func writeAuditAnchor(path string, key []byte, first *auditRecord) error {
+	a := &auditRecord{kind: auditKindAnchor, seq: first.seq, prev: first.prev, payload: first.digest}
+	a.digest = auditDigest(key, a.kind, a.seq, a.prev, a.payload)
+	tmp := auditAnchorPath(path) + ".tmp"
+	if err := ioutil.WriteFile(tmp, a.marshal(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, auditAnchorPath(path))
+}
+
+func readAuditAnchor(path string, key []byte) (*auditRecord, error) {
+	file := auditAnchorPath(path)
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &AuditError{File: file, Reason: "missing anchor"}
+		}
+		return nil, err
+	}
+	a, err := parseAuditRecord(strings.TrimSuffix(string(content), "\n"))
+	if err != nil {
+		return nil, &AuditError{File: file, Line: 1, Reason: err.Error()}
+	}
+	if a.kind != auditKindAnchor {
+		return nil, &AuditError{File: file, Line: 1, Seq: a.seq, Reason: "not an anchor"}
+	}
+	if !hmac.Equal([]byte(a.digest), []byte(auditDigest(key, a.kind, a.seq, a.prev, a.payload))) {
+		return nil, &AuditError{File: file, Line: 1, Seq: a.seq, Reason: "anchor digest mismatch"}
+	}
+	return a, nil
+}
+
+// VerifyAuditLog checks the hash chain of the audit log `path` across all of its
+// rotated backups, oldest first, and returns an `*AuditError` for the first
+// broken link. The chain must start at the record kept in the anchor file
+// `<path>.anchor`, the older records left by an interrupted removal of the
+// backups are skipped.
+func VerifyAuditLog(path string, key []byte) (err error) {
+	var files []string
+	if files, err = auditFiles(path); err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no audit log found at `%s`", path)
+	}
+	anchor, err := readAuditAnchor(path, key)
+	if err != nil {
+		return err
+	}
+
+	var prev *auditRecord
+	for _, file := range files {
+		if err = verifyAuditFile(file, key, anchor, &prev); err != nil {
+			return err
+		}
+	}
+	if prev == nil {
+		return &AuditError{File: path, Seq: anchor.seq, Reason: "anchored record not found"}
+	}
+	return nil
+}
+
+func verifyAuditFile(file string, key []byte, anchor *auditRecord, prev **auditRecord) error {
+	fp, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	scanner := newAuditScanner(fp)
+	for line := 1; scanner.Scan(); line++ {
+		r, err := parseAuditRecord(scanner.Text())
+		if err != nil {
+			return &AuditError{File: file, Line: line, Reason: err.Error()}
+		}
+		if r.kind == auditKindAnchor {
+			return &AuditError{File: file, Line: line, Seq: r.seq, Reason: "anchor record in the log"}
+		}
+		if *prev == nil {
+			if r.seq < anchor.seq {
+				continue
+			}
+			if r.seq != anchor.seq || r.prev != anchor.prev || r.digest != anchor.payload {
+				return &AuditError{File: file, Line: line, Seq: r.seq,
+					Reason: fmt.Sprintf("chain does not start at the anchor, expected seq %d", anchor.seq)}
+			}
+			if r.seq == 1 && r.prev != auditGenesis {
+				return &AuditError{File: file, Line: line, Seq: r.seq, Reason: "first record does not start the chain"}
+			}
+		} else {
+			if r.seq != (*prev).seq+1 {
+				return &AuditError{File: file, Line: line, Seq: r.seq,
+					Reason: fmt.Sprintf("sequence gap, expected %d", (*prev).seq+1)}
+			}
+			if r.prev != (*prev).digest {
+				return &AuditError{File: file, Line: line, Seq: r.seq, Reason: "previous digest mismatch"}
+			}
+		}
+		if !hmac.Equal([]byte(r.digest), []byte(auditDigest(key, r.kind, r.seq, r.prev, r.payload))) {
+			return &AuditError{File: file, Line: line, Seq: r.seq, Reason: "digest mismatch"}
+		}
+		*prev = r
+	}
+	return scanner.Err()
+}
+
+func lastAuditRecord(file string) (last *auditRecord, err error) {
+	fp, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer fp.Close()
+
+	scanner := newAuditScanner(fp)
+	for scanner.Scan() {
+		if r, err := parseAuditRecord(scanner.Text()); err == nil {
+			last = r
+		}
+	}
+	return last, scanner.Err()
+}
+
+func firstAuditRecord(file string) (*auditRecord, error) {
+	fp, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer fp.Close()
+
+	scanner := newAuditScanner(fp)
+	for scanner.Scan() {
+		if r, err := parseAuditRecord(scanner.Text()); err == nil {
+			return r, nil
+		}
+	}
+	return nil, scanner.Err()
+}
+
+func newAuditScanner(fp *os.File) *bufio.Scanner {
+	scanner := bufio.NewScanner(fp)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	return scanner
+}
+
+type auditBackup struct {
+	name string
+	time time.Time
+}
+
+// auditBackups returns the rotated backups of `path`, oldest first.
+func auditBackups(path string) (backups []auditBackup, err error) {
+	var (
+		ext    = filepath.Ext(path)
+		prefix = strings.TrimSuffix(filepath.Base(path), ext) + "-"
+	)
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), "*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matches {
+		name := filepath.Base(m)
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		if t, err := time.Parse(lumberjackBackupTimeFormat, ts); err == nil {
+			backups = append(backups, auditBackup{name: m, time: t})
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].name < backups[j].name })
+	return backups, nil
+}
+
+// auditFiles returns the rotated backups of `path` (oldest first) followed by
+// `path` itself, files that do not exist are skipped.
+func auditFiles(path string) (files []string, err error) {
+	backups, err := auditBackups(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range backups {
+		files = append(files, b.name)
+	}
+
+	if _, err = os.Stat(path); err == nil {
+		files = append(files, path)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return files, nil
+}
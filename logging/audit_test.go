@@ -0,0 +1,215 @@
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestAuditLogger(t *testing.T, file string, key []byte, checkpointEvery int) *Logger {
+	return newTestAuditLoggerLevel(t, DebugLevel, file, key, checkpointEvery, 3)
+}
+
+func newTestAuditLoggerLevel(t *testing.T, level Level, file string, key []byte, checkpointEvery, maxBackups int) *Logger {
+	w := NewAuditWriter(level, file, key, 1, maxBackups, 0)
+	w.CheckpointEvery = checkpointEvery
+	logger, err := NewLogger(DebugLevel, ErrorLevel, "audit", "", false, EncodeConsole, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logger
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	var (
+		file = filepath.Join(t.TempDir(), "audit.log")
+		key  = []byte("secret")
+	)
+
+	logger := newTestAuditLogger(t, file, key, 3)
+	for i := 0; i < 10; i++ {
+		logger.InfoW("user login", "user", "alice", "attempt", i)
+	}
+	_ = logger.Sync()
+
+	if err := VerifyAuditLog(file, key); err != nil {
+		t.Fatalf("untouched audit log: %v", err)
+	}
+	if err := VerifyAuditLog(file, []byte("wrong")); err == nil {
+		t.Fatal("expected digest mismatch with a wrong key")
+	}
+
+	// a new logger continues the chain of the existing file
+	logger = newTestAuditLogger(t, file, key, 3)
+	logger.Info("after restart")
+	_ = logger.Sync()
+	if err := VerifyAuditLog(file, key); err != nil {
+		t.Fatalf("resumed audit log: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(content), "\nC "); n != 3 {
+		t.Errorf("expected 3 checkpoints, got %d", n)
+	}
+
+	lines := strings.Split(string(content), "\n")
+	lines[4] = strings.Replace(lines[4], "alice", "mallory", 1)
+	if err = ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = VerifyAuditLog(file, key)
+	auditErr, ok := err.(*AuditError)
+	if !ok {
+		t.Fatalf("expected *AuditError, got %v", err)
+	}
+	if auditErr.Line != 5 || auditErr.Seq != 5 {
+		t.Errorf("expected broken link at line 5, got %v", auditErr)
+	}
+}
+
+func TestVerifyAuditLogRotated(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+
+	logger := newTestAuditLogger(t, file, nil, 0)
+	payload := strings.Repeat("x", 4096)
+	for i := 0; i < 300; i++ {
+		logger.InfoW("bulk", "payload", payload)
+	}
+	_ = logger.Sync()
+
+	files, err := auditFiles(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 2 {
+		t.Fatalf("expected rotated backups, got %v", files)
+	}
+	if err = VerifyAuditLog(file, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// removing a whole backup in the middle of the chain is detected
+	logger = newTestAuditLogger(t, file, nil, 0)
+	for i := 0; i < 300; i++ {
+		logger.InfoW("bulk", "payload", payload)
+	}
+	_ = logger.Sync()
+	if files, err = auditFiles(file); err != nil || len(files) < 3 {
+		t.Fatalf("expected at least 3 files, got %v (%v)", files, err)
+	}
+	if err = ioutil.WriteFile(files[1], nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyAuditLog(file, nil); err == nil {
+		t.Fatal("expected a broken chain after truncating a backup")
+	}
+}
+
+func TestVerifyAuditLogInfoLevel(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	logger := newTestAuditLoggerLevel(t, InfoLevel, file, nil, 0, 3)
+	logger.Info("user login")
+	_ = logger.Sync()
+
+	// the audit log is not renamed after its level
+	if err := VerifyAuditLog(file, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyAuditLogAnchor(t *testing.T) {
+	var (
+		file    = filepath.Join(t.TempDir(), "audit.log")
+		key     = []byte("secret")
+		payload = strings.Repeat("x", 4096)
+	)
+	logger := newTestAuditLoggerLevel(t, DebugLevel, file, key, 0, 1)
+	for i := 0; i < 700; i++ {
+		logger.InfoW("bulk", "payload", payload)
+	}
+	_ = logger.Sync()
+
+	// the backups beyond `MaxBackups` are removed, the anchor follows
+	files, err := auditFiles(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 1 backup and the log, got %v", files)
+	}
+	if err = VerifyAuditLog(file, key); err != nil {
+		t.Fatal(err)
+	}
+
+	// removing the oldest backup is detected
+	backup, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(files[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyAuditLog(file, key); err == nil {
+		t.Fatal("expected a broken chain without the oldest backup")
+	}
+
+	// so is truncating the start of the chain
+	lines := strings.SplitAfter(string(backup), "\n")
+	if err = ioutil.WriteFile(files[0], []byte(strings.Join(lines[2:], "")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = VerifyAuditLog(file, key)
+	if auditErr, ok := err.(*AuditError); !ok || auditErr.Line != 1 {
+		t.Fatalf("expected a broken chain at line 1 after truncating the start, got %v", err)
+	}
+
+	// the anchor itself must not be removed
+	if err = ioutil.WriteFile(files[0], backup, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyAuditLog(file, key); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(auditAnchorPath(file)); err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyAuditLog(file, key); err == nil {
+		t.Fatal("expected an error without anchor")
+	}
+}
+
+func TestVerifyAuditLogTornRecord(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	logger := newTestAuditLogger(t, file, nil, 0)
+	logger.Info("before crash")
+	_ = logger.Close()
+
+	// a crash in the middle of a record
+	fp, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fp.WriteString(`E 2 0123 4567 "half wri`); err != nil {
+		t.Fatal(err)
+	}
+	_ = fp.Close()
+
+	logger = newTestAuditLogger(t, file, nil, 0)
+	logger.Info("after restart")
+	_ = logger.Close()
+	if err = VerifyAuditLog(file, nil); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "half wri") || !strings.Contains(string(content), "torn=23") {
+		t.Errorf("torn record not recovered:\n%s", content)
+	}
+}
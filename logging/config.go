@@ -3,12 +3,10 @@ package logging
 import (
 	"errors"
 	"fmt"
-	"go.uber.org/zap/zapcore"
 	"sync"
 )
 
 var (
-	__l = new(zapcore.Level)
 	_lc = NewLoggerContainer() // global loggers pool
 )
 
@@ -36,8 +34,8 @@ func (lc *LoggerPool) GetLogger(name string) (logger *Logger, err error) {
 
 func SetConf(conf string) (lp *LoggerPool, err error) {
 	_lc.__loggerContainersOnce.Do(func() {
-		if err := initLoggersContainers(conf); err != nil {
-			lp, err = nil, fmt.Errorf("set logging conf `%s` failed", conf)
+		if initErr := initLoggersContainers(conf); initErr != nil {
+			lp, err = nil, fmt.Errorf("set logging conf `%s` failed: %w", conf, initErr)
 			return
 		}
 		lp, err = _lc, nil
@@ -48,6 +46,13 @@ func SetConf(conf string) (lp *LoggerPool, err error) {
 // initLoggersContainers initializes a pool of log objects
 func initLoggersContainers(conf string) (err error) {
 
+	// report every problem at once, instead of failing (or panicking) on the first one
+	if err = ValidateConf(conf); err != nil {
+		if problems, ok := err.(ConfErrors); !ok || problems.HasErrors() {
+			return err
+		}
+	}
+
 	var c *confParser
 	if c, err = NewConfParser(conf); err != nil {
 		return err
@@ -70,18 +75,27 @@ func initLoggersContainers(conf string) (err error) {
 			}
 			switch c.ValHandlerClass(handlerName) {
 			case ClassRotateFile:
-				handlers = append(handlers, NewRotateWriter(
+				writer := NewRotateWriter(
 					c.ValHandlerLevel(handlerName),
 					c.ValHandlerLogFile(handlerName),
 					c.ValHandlerMaxSize(handlerName),
 					c.ValHandlerMaxBackups(handlerName),
-					c.ValHandlerMaxAge(handlerName)))
+					c.ValHandlerMaxAge(handlerName))
+				if keyFile, keyEnv := c.ValHandlerEncryptKeyFile(handlerName),
+					c.ValHandlerEncryptKeyEnv(handlerName); keyFile != "" || keyEnv != "" {
+					if writer.EncryptKey, err = LoadEncryptionKey(keyFile, keyEnv); err != nil {
+						return fmt.Errorf("load encryption key of handler `%s`: %v", handlerName, err)
+					}
+					writer.EncryptKeyID = c.ValHandlerEncryptKeyID(handlerName)
+				}
+				handlers = append(handlers, writer)
 			case ClassConsole:
 				handlers = append(handlers, NewConsoleWriter(
 					c.ValHandlerLevel(handlerName)))
 			default:
-				return errors.New("unsupported handler class `%s`," +
-					"only `logging.NewFileRotatingLogger` and `logging.NewConsoleStreamingLogger` are valid")
+				return fmt.Errorf("unsupported handler class `%s`, "+
+					"only `logging.NewFileRotatingLogger` and `logging.NewConsoleStreamingLogger` are valid",
+					c.ValHandlerClass(handlerName))
 			}
 		}
 
@@ -96,6 +110,7 @@ func initLoggersContainers(conf string) (err error) {
 			return err
 		} else {
 			_lc.__containers[loggerName] = logger
+			Register(logger)
 		}
 	}
 
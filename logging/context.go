@@ -0,0 +1,20 @@
+package logging
+
+import "context"
+
+type loggerCtxKey struct{}
+
+// NewContext returns a copy of `ctx` carrying `logger`.
+func NewContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, loggerCtxKey{}, logger)
+}
+
+// FromContext returns the logger carried by `ctx`, or the global logger if there is none.
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerCtxKey{}).(*Logger); ok && logger != nil {
+			return logger
+		}
+	}
+	return GLogger()
+}
@@ -0,0 +1,345 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// encrypt ...
+//
+// An encrypted log file is a sequence of self-contained AES-GCM frames, so that
+// rotation, restarts and key changes never need a file header:
+//
+//     magic(4) | len(key id)(1) | key id | salt(16) | counter(8) | len(ciphertext)(4) | ciphertext
+//
+// Every writer draws a random salt and seals its frames with a subkey derived
+// from the key and the salt, the nonce being the frame counter, so that no
+// nonce is ever reused whatever the volume. The frame header is authenticated
+// as additional data and a reader checks that the counter follows the previous
+// frame of the same salt, or starts at 0 with a new salt: dropped or reordered
+// frames fail decryption. Only the first frame read may start in the middle
+// of a stream, the file begins after a rotation. Writes larger than
+// `encryptChunkSize` are split over several frames.
+
+const (
+	encryptMagic       = "GLE1"
+	encryptChunkSize   = 64 * 1024
+	encryptSaltSize    = 16
+	encryptCounterSize = 8
+	encryptNonceSize   = 12
+)
+
+var (
+	ErrEncryptedFrame = errors.New("malformed encrypted log frame")
+	ErrFrameSequence  = errors.New("encrypted log frame dropped or reordered")
+
+	errTornFrame = errors.New("torn encrypted log frame")
+)
+
+// FrameSkipError is returned instead of `io.EOF` by the reader of
+// `NewDecryptingReader` if it skipped malformed frames, it matches `ErrEncryptedFrame`.
+type FrameSkipError struct {
+	Frames int   // malformed frames
+	Bytes  int64 // bytes skipped
+}
+
+func (e *FrameSkipError) Error() string {
+	return fmt.Sprintf("skipped %d malformed encrypted log frames (%d bytes)", e.Frames, e.Bytes)
+}
+
+func (e *FrameSkipError) Unwrap() error {
+	return ErrEncryptedFrame
+}
+
+// LoadEncryptionKey reads an AES key from `keyFile`, or from the environment
+// variable `keyEnv` when `keyFile` is empty. The key may be hex, base64 or raw
+// bytes, and must be 16, 24 or 32 bytes long once decoded.
+func LoadEncryptionKey(keyFile, keyEnv string) (key []byte, err error) {
+	var raw []byte
+	switch {
+	case keyFile != "":
+		if raw, err = ioutil.ReadFile(keyFile); err != nil {
+			return nil, err
+		}
+	case keyEnv != "":
+		v, ok := os.LookupEnv(keyEnv)
+		if !ok {
+			return nil, fmt.Errorf("environment variable `%s` is not set", keyEnv)
+		}
+		raw = []byte(v)
+	default:
+		return nil, errors.New("neither key file nor key environment variable is given")
+	}
+	return parseEncryptionKey(raw)
+}
+
+func parseEncryptionKey(raw []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if k, err := hex.DecodeString(string(trimmed)); err == nil && validAESKeySize(len(k)) {
+		return k, nil
+	}
+	if k, err := base64.StdEncoding.DecodeString(string(trimmed)); err == nil && validAESKeySize(len(k)) {
+		return k, nil
+	}
+	if validAESKeySize(len(raw)) {
+		return raw, nil
+	}
+	if validAESKeySize(len(trimmed)) {
+		return trimmed, nil
+	}
+	return nil, errors.New("encryption key must be 16, 24 or 32 bytes (raw, hex or base64)")
+}
+
+func validAESKeySize(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
+
+// EncryptionKeyID returns the default key id of `key`, it is stored in every
+// frame so that readers can pick the right key after a key rotation.
+func EncryptionKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// newFrameGCM returns the AEAD of the frames salted with `salt`, keyed by
+// HMAC-SHA256(key, salt) truncated to the size of `key`.
+func newFrameGCM(key, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil)[:len(key)])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func frameNonce(counter uint64) []byte {
+	nonce := make([]byte, encryptNonceSize)
+	binary.BigEndian.PutUint64(nonce[encryptNonceSize-encryptCounterSize:], counter)
+	return nonce
+}
+
+// encryptSyncer seals everything zap writes before handing it to `out`.
+type encryptSyncer struct {
+	mu      sync.Mutex
+	out     zapcore.WriteSyncer
+	aead    cipher.AEAD
+	keyID   string
+	salt    []byte
+	counter uint64 // the counter of the next frame
+}
+
+func newEncryptSyncer(out zapcore.WriteSyncer, keyID string, key []byte) (s *encryptSyncer, err error) {
+	if keyID == "" {
+		keyID = EncryptionKeyID(key)
+	}
+	if len(keyID) > 255 {
+		return nil, fmt.Errorf("encryption key id `%s` is too long", keyID)
+	}
+	s = &encryptSyncer{out: out, keyID: keyID, salt: make([]byte, encryptSaltSize)}
+	if _, err = io.ReadFull(rand.Reader, s.salt); err != nil {
+		return nil, err
+	}
+	if s.aead, err = newFrameGCM(key, s.salt); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *encryptSyncer) Write(p []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > encryptChunkSize {
+			chunk = chunk[:encryptChunkSize]
+		}
+		if err = s.writeFrame(chunk); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+func (s *encryptSyncer) writeFrame(plain []byte) error {
+	headerLen := len(encryptMagic) + 1 + len(s.keyID) + encryptSaltSize + encryptCounterSize + 4
+	frame := make([]byte, headerLen, headerLen+len(plain)+s.aead.Overhead())
+
+	off := copy(frame, encryptMagic)
+	frame[off] = byte(len(s.keyID))
+	off++
+	off += copy(frame[off:], s.keyID)
+	off += copy(frame[off:], s.salt)
+	binary.BigEndian.PutUint64(frame[off:], s.counter)
+	off += encryptCounterSize
+	binary.BigEndian.PutUint32(frame[off:], uint32(len(plain)+s.aead.Overhead()))
+
+	frame = s.aead.Seal(frame, frameNonce(s.counter), plain, frame[:headerLen])
+	// the counter moves on even if the write fails, a nonce is never reused
+	s.counter++
+	_, err := s.out.Write(frame)
+	return err
+}
+
+func (s *encryptSyncer) Sync() error {
+	return s.out.Sync()
+}
+
+type decryptingReader struct {
+	r    *bufio.Reader
+	keys map[string][]byte
+	buf  []byte
+	err  error
+
+	// the stream of the last frame
+	keyID   string
+	salt    []byte
+	aead    cipher.AEAD
+	next    uint64 // the expected counter of the next frame
+	started bool
+
+	skipped FrameSkipError
+}
+
+// NewDecryptingReader returns a reader of the plain log text in the encrypted
+// stream `r`, `keys` maps key ids (see `EncryptionKeyID`) to AES keys. The
+// frames that fail decryption, e.g. torn by a crash or a full disk, or sealed
+// with a key that is not given, are skipped up to the next frame and reported
+// by a `*FrameSkipError` at the end of the stream.
+func NewDecryptingReader(r io.Reader, keys map[string][]byte) io.Reader {
+	return &decryptingReader{r: bufio.NewReader(r), keys: keys}
+}
+
+func (d *decryptingReader) Read(p []byte) (n int, err error) {
+	for len(d.buf) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.buf, d.err = d.nextFrame()
+	}
+	n = copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptingReader) nextFrame() (plain []byte, err error) {
+	for {
+		var consumed []byte
+		if plain, consumed, err = d.readFrame(); err != errTornFrame {
+			if err == io.EOF && d.skipped.Frames > 0 {
+				skipped := d.skipped
+				return nil, &skipped
+			}
+			return plain, err
+		}
+		// the frames after the gap may start anywhere in their stream
+		d.started = false
+		d.resync(consumed)
+	}
+}
+
+// readFrame reads the next frame, it returns `errTornFrame` and the bytes it
+// consumed if the frame is malformed.
+func (d *decryptingReader) readFrame() (plain, consumed []byte, err error) {
+	header := make([]byte, len(encryptMagic)+1, 64)
+	if n, err := io.ReadFull(d.r, header); err != nil {
+		if err == io.EOF {
+			return nil, nil, io.EOF
+		}
+		return nil, header[:n], errTornFrame
+	}
+	if string(header[:len(encryptMagic)]) != encryptMagic {
+		return nil, header, errTornFrame
+	}
+
+	rest := make([]byte, int(header[len(encryptMagic)])+encryptSaltSize+encryptCounterSize+4)
+	if n, err := io.ReadFull(d.r, rest); err != nil {
+		return nil, append(header, rest[:n]...), errTornFrame
+	}
+	header = append(header, rest...)
+
+	var (
+		keyID   = string(rest[:len(rest)-encryptSaltSize-encryptCounterSize-4])
+		salt    = rest[len(keyID) : len(keyID)+encryptSaltSize]
+		counter = binary.BigEndian.Uint64(rest[len(keyID)+encryptSaltSize:])
+		ctLen   = binary.BigEndian.Uint32(rest[len(rest)-4:])
+		sealed  []byte
+	)
+	aead, fresh := d.aead, keyID != d.keyID || !bytes.Equal(salt, d.salt)
+	if fresh {
+		// a header torn within its key id or salt does not match any key
+		if aead, err = d.streamAEAD(keyID, salt); err != nil {
+			return nil, header, errTornFrame
+		}
+	}
+	if ctLen > uint32(encryptChunkSize+aead.Overhead()) {
+		return nil, header, errTornFrame
+	}
+	sealed = make([]byte, ctLen)
+	if n, err := io.ReadFull(d.r, sealed); err != nil {
+		return nil, append(header, sealed[:n]...), errTornFrame
+	}
+	// a torn frame reads the start of the next one as its ciphertext
+	if plain, err = aead.Open(nil, frameNonce(counter), sealed, header); err != nil {
+		return nil, append(header, sealed...), errTornFrame
+	}
+
+	// a new stream starts at 0, unless it is the first one read
+	if d.started && ((fresh && counter != 0) || (!fresh && counter != d.next)) {
+		return nil, nil, ErrFrameSequence
+	}
+	if fresh {
+		d.keyID, d.salt, d.aead = keyID, append(d.salt[:0], salt...), aead
+	}
+	d.next, d.started = counter+1, true
+	return plain, nil, nil
+}
+
+// resync skips the malformed frame whose bytes `consumed` were read, up to the
+// next frame magic or the end of the stream.
+func (d *decryptingReader) resync(consumed []byte) {
+	d.skipped.Frames++
+	if len(consumed) > 0 {
+		// the next frame may start within the consumed bytes
+		d.skipped.Bytes++
+		d.r = bufio.NewReader(io.MultiReader(bytes.NewReader(consumed[1:]), d.r))
+	}
+	for {
+		b, err := d.r.Peek(len(encryptMagic))
+		if err == nil && string(b) == encryptMagic {
+			return
+		}
+		if len(b) == 0 {
+			return
+		}
+		_, _ = d.r.Discard(1)
+		d.skipped.Bytes++
+	}
+}
+
+func (d *decryptingReader) streamAEAD(keyID string, salt []byte) (cipher.AEAD, error) {
+	key, ok := d.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key id `%s`", keyID)
+	}
+	return newFrameGCM(key, salt)
+}
@@ -0,0 +1,211 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestEncryptedLogger(t *testing.T, file string, key []byte) *Logger {
+	w := NewRotateWriter(DebugLevel, file, 1, 3, 0)
+	w.EncryptKey = key
+	logger, err := NewLogger(DebugLevel, ErrorLevel, "encrypted", "", false, EncodeConsole, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logger
+}
+
+func TestEncryptedRotateWriter(t *testing.T) {
+	var (
+		file   = filepath.Join(t.TempDir(), "secret.log")
+		oldKey = bytes.Repeat([]byte{1}, 32)
+		newKey = bytes.Repeat([]byte{2}, 16)
+	)
+
+	logger := newTestEncryptedLogger(t, file, oldKey)
+	logger.InfoW("customer", "email", "alice@example.com")
+	logger.Info(strings.Repeat("y", encryptChunkSize+10))
+	_ = logger.Sync()
+
+	// rotate the key, new frames are appended to the same file
+	logger = newTestEncryptedLogger(t, file, newKey)
+	logger.InfoW("customer", "email", "bob@example.com")
+	_ = logger.Sync()
+
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("example.com")) {
+		t.Fatal("plain text found in encrypted log file")
+	}
+
+	keys := map[string][]byte{
+		EncryptionKeyID(oldKey): oldKey,
+		EncryptionKeyID(newKey): newKey,
+	}
+	plain, err := ioutil.ReadAll(NewDecryptingReader(bytes.NewReader(raw), keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(plain), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+	if !strings.Contains(lines[0], "alice@example.com") || !strings.Contains(lines[2], "bob@example.com") {
+		t.Errorf("unexpected plain text: %q", plain)
+	}
+
+	delete(keys, EncryptionKeyID(newKey))
+	if _, err = ioutil.ReadAll(NewDecryptingReader(bytes.NewReader(raw), keys)); err == nil {
+		t.Error("expected an error for an unknown key id")
+	}
+
+	raw[len(raw)-1] ^= 0xff
+	keys[EncryptionKeyID(newKey)] = newKey
+	if _, err = ioutil.ReadAll(NewDecryptingReader(bytes.NewReader(raw), keys)); err == nil {
+		t.Error("expected an error for a tampered frame")
+	}
+}
+
+// splitFrames splits an encrypted stream into its frames.
+func splitFrames(t *testing.T, raw []byte) (frames [][]byte) {
+	for len(raw) > 0 {
+		off := len(encryptMagic) + 1 + int(raw[len(encryptMagic)]) + encryptSaltSize + encryptCounterSize
+		n := off + 4 + int(binary.BigEndian.Uint32(raw[off:]))
+		if n > len(raw) {
+			t.Fatal("truncated frame")
+		}
+		frames, raw = append(frames, raw[:n]), raw[n:]
+	}
+	return frames
+}
+
+func TestEncryptedFrameSequence(t *testing.T) {
+	var (
+		key  = bytes.Repeat([]byte{3}, 32)
+		keys = map[string][]byte{EncryptionKeyID(key): key}
+		out  = new(syncBuffer)
+	)
+	s, err := newEncryptSyncer(out, "", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"a\n", "b\n", "c\n"} {
+		if _, err = s.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	frames := splitFrames(t, []byte(out.String()))
+	if len(frames) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(frames))
+	}
+
+	read := func(frames ...[]byte) (string, error) {
+		plain, err := ioutil.ReadAll(NewDecryptingReader(bytes.NewReader(bytes.Join(frames, nil)), keys))
+		return string(plain), err
+	}
+	if plain, err := read(frames...); err != nil || plain != "a\nb\nc\n" {
+		t.Fatalf("unexpected plain text %q (%v)", plain, err)
+	}
+	// a file may start in the middle of a stream after a rotation
+	if plain, err := read(frames[1:]...); err != nil || plain != "b\nc\n" {
+		t.Fatalf("unexpected plain text %q (%v)", plain, err)
+	}
+
+	if _, err = read(frames[0], frames[2]); !errors.Is(err, ErrFrameSequence) {
+		t.Errorf("expected ErrFrameSequence for a dropped frame, got %v", err)
+	}
+	if _, err = read(frames[0], frames[2], frames[1]); !errors.Is(err, ErrFrameSequence) {
+		t.Errorf("expected ErrFrameSequence for reordered frames, got %v", err)
+	}
+
+	// the counter is authenticated
+	forged := append([]byte(nil), frames[2]...)
+	forged[len(encryptMagic)+1+int(forged[len(encryptMagic)])+encryptSaltSize+encryptCounterSize-1] = 1
+	if _, err = read(frames[0], forged); err == nil {
+		t.Error("expected an error for a forged counter")
+	}
+
+	// a new writer starts a new stream at 0
+	s, err = newEncryptSyncer(out, "", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Write([]byte("d\n")); err != nil {
+		t.Fatal(err)
+	}
+	next := splitFrames(t, []byte(out.String()))[3]
+	if plain, err := read(frames[0], frames[1], next); err != nil || plain != "a\nb\nd\n" {
+		t.Fatalf("unexpected plain text %q (%v)", plain, err)
+	}
+}
+
+func TestEncryptedTornFrame(t *testing.T) {
+	var (
+		key  = bytes.Repeat([]byte{4}, 16)
+		keys = map[string][]byte{EncryptionKeyID(key): key}
+		out  = new(syncBuffer)
+	)
+	s, err := newEncryptSyncer(out, "", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"a\n", "b\n", "c\n"} {
+		if _, err = s.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	frames := splitFrames(t, []byte(out.String()))
+	torn := frames[1][:len(frames[1])/2]
+
+	for _, tc := range []struct {
+		raw  [][]byte
+		want string
+	}{
+		{raw: [][]byte{frames[0], torn, frames[2]}, want: "a\nc\n"},
+		{raw: [][]byte{frames[0], torn}, want: "a\n"},
+		{raw: [][]byte{torn, frames[2]}, want: "c\n"},
+	} {
+		plain, err := ioutil.ReadAll(NewDecryptingReader(bytes.NewReader(bytes.Join(tc.raw, nil)), keys))
+		if string(plain) != tc.want {
+			t.Errorf("expected %q after the torn frame, got %q", tc.want, plain)
+		}
+		var skipped *FrameSkipError
+		if !errors.As(err, &skipped) || !errors.Is(err, ErrEncryptedFrame) {
+			t.Fatalf("expected a FrameSkipError, got %v", err)
+		}
+		if skipped.Frames != 1 || skipped.Bytes != int64(len(torn)) {
+			t.Errorf("expected 1 frame and %d bytes skipped, got %v", len(torn), skipped)
+		}
+	}
+}
+
+func TestLoadEncryptionKey(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+
+	keyFile := filepath.Join(t.TempDir(), "log.key")
+	if err := ioutil.WriteFile(keyFile, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if k, err := LoadEncryptionKey(keyFile, ""); err != nil || !bytes.Equal(k, key) {
+		t.Errorf("hex key file: %x, %v", k, err)
+	}
+
+	_ = os.Setenv("GOPKG_TEST_LOG_KEY", "0123456789abcdef")
+	defer os.Unsetenv("GOPKG_TEST_LOG_KEY")
+	if k, err := LoadEncryptionKey("", "GOPKG_TEST_LOG_KEY"); err != nil || string(k) != "0123456789abcdef" {
+		t.Errorf("raw env key: %q, %v", k, err)
+	}
+
+	if _, err := LoadEncryptionKey("", "GOPKG_TEST_LOG_KEY_MISSING"); err == nil {
+		t.Error("expected an error for a missing environment variable")
+	}
+}
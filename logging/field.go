@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Field is a strongly typed key/value pair. Unlike the values passed to the
+// `xxxW` methods, fields are not boxed into `interface{}` and the `xxxT` methods
+// write them to the base logger directly, without the sugared logger.
+type Field = zap.Field
+
+// String constructs a field with the given key and value.
+func String(key string, val string) Field {
+	return zap.String(key, val)
+}
+
+// Strings constructs a field that carries a slice of strings.
+func Strings(key string, val []string) Field {
+	return zap.Strings(key, val)
+}
+
+// ByteString constructs a field that carries UTF-8 encoded text as a []byte.
+func ByteString(key string, val []byte) Field {
+	return zap.ByteString(key, val)
+}
+
+// Int constructs a field with the given key and value.
+func Int(key string, val int) Field {
+	return zap.Int(key, val)
+}
+
+// Int64 constructs a field with the given key and value.
+func Int64(key string, val int64) Field {
+	return zap.Int64(key, val)
+}
+
+// Uint64 constructs a field with the given key and value.
+func Uint64(key string, val uint64) Field {
+	return zap.Uint64(key, val)
+}
+
+// Float64 constructs a field with the given key and value.
+func Float64(key string, val float64) Field {
+	return zap.Float64(key, val)
+}
+
+// Bool constructs a field with the given key and value.
+func Bool(key string, val bool) Field {
+	return zap.Bool(key, val)
+}
+
+// Duration constructs a field with the given key and value.
+func Duration(key string, val time.Duration) Field {
+	return zap.Duration(key, val)
+}
+
+// Time constructs a field with the given key and value.
+func Time(key string, val time.Time) Field {
+	return zap.Time(key, val)
+}
+
+// Err constructs a field that carries `err` under the key `error`.
+func Err(err error) Field {
+	return zap.Error(err)
+}
+
+// NamedErr constructs a field that carries `err` under the given key.
+func NamedErr(key string, err error) Field {
+	return zap.NamedError(key, err)
+}
+
+// Any takes a key and an arbitrary value and chooses the best way to represent
+// them as a field, falling back to reflection only if necessary.
+func Any(key string, val interface{}) Field {
+	return zap.Any(key, val)
+}
+
+// With returns a child logger that adds `fields` to every entry, the child
+// shares the handlers of `l`.
+func (l *Logger) With(fields ...Field) *Logger {
+	child := *l
+	child.baseLogger = l.baseLogger.With(fields...)
+	// baseLogger already skips the frame of our wrappers, see `sugared`
+	child.sLogger = child.baseLogger.Sugar()
+	return &child
+}
+
+// LogT logs a message and typed fields at `level`
+func (l *Logger) LogT(level Level, msg string, fields ...Field) {
+	if ce := l.baseLogger.Check(level, msg); ce != nil {
+		ce.Write(fields...)
+	}
+}
+
+// DebugT logs a message and typed fields at DEBUG level
+func (l *Logger) DebugT(msg string, fields ...Field) {
+	l.baseLogger.Debug(msg, fields...)
+}
+
+// InfoT logs a message and typed fields at INFO level
+func (l *Logger) InfoT(msg string, fields ...Field) {
+	l.baseLogger.Info(msg, fields...)
+}
+
+// WarnT logs a message and typed fields at WARN level
+func (l *Logger) WarnT(msg string, fields ...Field) {
+	l.baseLogger.Warn(msg, fields...)
+}
+
+// ErrorT logs a message and typed fields at ERROR level
+func (l *Logger) ErrorT(msg string, fields ...Field) {
+	l.baseLogger.Error(msg, fields...)
+}
+
+// FatalT logs a message and typed fields at FATAL level
+func (l *Logger) FatalT(msg string, fields ...Field) {
+	l.baseLogger.Fatal(msg, fields...)
+}
+
+// PanicT logs a message and typed fields at Panic level
+func (l *Logger) PanicT(msg string, fields ...Field) {
+	l.baseLogger.Panic(msg, fields...)
+}
+
+// DPanicT logs a message and typed fields at DPanic level
+func (l *Logger) DPanicT(msg string, fields ...Field) {
+	l.baseLogger.DPanic(msg, fields...)
+}
@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLoggerTyped(t *testing.T) {
+	out := new(syncBuffer)
+	logger := newTestLogger(t, EncodeJson, DebugLevel, out)
+
+	logger.With(String("request", "r-1")).InfoT("typed",
+		String("k", "v"), Int("n", 3), Bool("ok", true), Err(errors.New("boom")))
+	logger.LogT(WarnLevel, "leveled", Duration("took", time.Second))
+	logger.DebugT("debug")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 entries, got %q", out.String())
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]interface{}{
+		"message": "typed", "level": "INFO", "request": "r-1",
+		"k": "v", "n": float64(3), "ok": true, "error": "boom",
+	} {
+		if entry[k] != v {
+			t.Errorf("%s: expected %v, got %v", k, v, entry[k])
+		}
+	}
+	if caller, _ := entry["caller"].(string); !strings.Contains(caller, "field_test.go") {
+		t.Errorf("unexpected caller %q", caller)
+	}
+	if !strings.Contains(lines[1], `"level":"WARN"`) || !strings.Contains(lines[1], "field_test.go") {
+		t.Errorf("unexpected LogT entry %q", lines[1])
+	}
+}
+
+func newBenchmarkLogger(b *testing.B) *Logger {
+	return newTestLogger(b, EncodeJson, DebugLevel, zapcore.AddSync(ioutil.Discard))
+}
+
+func BenchmarkInfoT(b *testing.B) {
+	logger := newBenchmarkLogger(b)
+	err := errors.New("boom")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.InfoT("benchmark", String("k", "v"), Int("n", i), Err(err))
+	}
+}
+
+func BenchmarkInfoW(b *testing.B) {
+	logger := newBenchmarkLogger(b)
+	err := errors.New("boom")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.InfoW("benchmark", "k", "v", "n", i, "error", err)
+	}
+}
+
+func BenchmarkInfoF(b *testing.B) {
+	logger := newBenchmarkLogger(b)
+	err := errors.New("boom")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.InfoF("benchmark k=%s n=%d error=%v", "v", i, err)
+	}
+}
+
+func BenchmarkDebugTDisabled(b *testing.B) {
+	logger := newTestLogger(b, EncodeJson, InfoLevel, zapcore.AddSync(ioutil.Discard))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.DebugT("benchmark", String("k", "v"), Int("n", i))
+	}
+}
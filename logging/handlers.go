@@ -1,6 +1,8 @@
 package logging
 
 import (
+	"io"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -13,6 +15,19 @@ type rotateWriter struct {
 	MaxBackups  int    // Maximum backup number
 	MaxAge      int    // Maximum backup days
 	Compress    bool   // Whether to compress expiration logs
+
+	EncryptKey   []byte // AES key, log files are encrypted with AES-GCM when set
+	EncryptKeyID string // key id stored in every frame, derived from `EncryptKey` when empty
+}
+
+type auditWriter struct {
+	Level           Level
+	LogSavePath     string // path for saving logs
+	MaxSize         int    // size of backup
+	MaxBackups      int    // Maximum backup number
+	MaxAge          int    // Maximum backup days
+	Key             []byte // HMAC key, plain SHA-256 is used when empty
+	CheckpointEvery int    // a signed checkpoint is appended after every `CheckpointEvery` entries
 }
 
 type consoleWriter struct {
@@ -22,8 +37,11 @@ type consoleWriter struct {
 // TODO socket-writer、memory-writer、(more...)
 
 type handler struct {
+	Name       string // log file, or `stdout`
 	Sync       zapcore.WriteSyncer
 	EnableFunc zap.LevelEnablerFunc
+	stats      *handlerStats
+	closer     io.Closer // closes the log file, nil for the console
 }
 
 // NewRotateWriter returns rotate logs configuration
@@ -43,3 +61,17 @@ func NewConsoleWriter(level Level) *consoleWriter {
 	c.Level = level
 	return c
 }
+
+// NewAuditWriter returns tamper-evident audit logs configuration, records are
+// chained by HMAC-SHA256 with `key`, or by SHA-256 if `key` is empty.
+func NewAuditWriter(level Level, file string, key []byte, maxSize, maxBackups, maxAges int) *auditWriter {
+	a := new(auditWriter)
+	a.Level = level
+	a.LogSavePath = file
+	a.Key = key
+	a.MaxSize = maxSize
+	a.MaxAge = maxAges
+	a.MaxBackups = maxBackups
+	a.CheckpointEvery = defaultAuditCheckpointEvery
+	return a
+}
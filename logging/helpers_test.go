@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// syncBuffer is a goroutine safe `zapcore.WriteSyncer` for tests.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Sync() error { return nil }
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newTestLogger returns a logger like `NewLogger` does, which writes to `out`
+// at `handlerLevel` and above.
+func newTestLogger(t testing.TB, encoder Encoder, handlerLevel Level, out zapcore.WriteSyncer) *Logger {
+	logger := new(Logger)
+	logger.name_ = t.Name()
+	logger.level_ = DebugLevel
+	logger.stats = new(loggerStats)
+	logger.format_ = encoder
+	logger.config_ = DefaultConfig("2006/01/02 - 15:04:05.000")
+	logger.config_.EncodeLevel = zapcore.CapitalLevelEncoder
+	logger.initHandlers()
+	stats := new(handlerStats)
+	logger.addHandler("test", newMeteredSyncer(out, stats, nil), handlerLevel, stats, nil)
+	logger.baseLogger = zap.New(logger.GetAndBuildCore(logger.config_), zap.AddCaller())
+	return logger.sugared()
+}
@@ -0,0 +1,253 @@
+// Package httplog provides an HTTP access-log middleware built on `logging.Logger`.
+package httplog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	mrand "math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kisunSea/gopkg/logging"
+)
+
+const (
+	DefaultRequestIDHeader = "X-Request-Id"
+	redacted               = "[REDACTED]"
+)
+
+// DefaultRedactHeaders are the headers whose values are never logged.
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// Config configures the access-log middleware, see `NewConfig` for the defaults.
+type Config struct {
+	// Logger receives the access logs, `logging.GLogger()` when nil
+	Logger *logging.Logger
+	// Levels by status class, the key is `status / 100`, classes without a level are not logged
+	Levels map[int]logging.Level
+	// SuccessSampleRate is the fraction of 2xx responses that are logged, from 0 to 1
+	SuccessSampleRate float64
+	// MaxRequestBody is the number of bytes of the request body logged, 0 disables the capture
+	MaxRequestBody int
+	// MaxResponseBody is the number of bytes of the response body logged, 0 disables the capture
+	MaxResponseBody int
+	// LogHeaders logs the request headers, the values of `RedactHeaders` are replaced
+	LogHeaders    bool
+	RedactHeaders []string
+	// RequestIDHeader is read from the request, a random id is generated when it is missing,
+	// and the id is sent back in the response
+	RequestIDHeader string
+}
+
+// NewConfig returns the default configuration: INFO for 1xx, 2xx and 3xx,
+// WARN for 4xx and ERROR for 5xx, every request logged without headers or bodies.
+func NewConfig(logger *logging.Logger) *Config {
+	return &Config{
+		Logger: logger,
+		Levels: map[int]logging.Level{
+			1: logging.InfoLevel,
+			2: logging.InfoLevel,
+			3: logging.InfoLevel,
+			4: logging.WarnLevel,
+			5: logging.ErrorLevel,
+		},
+		SuccessSampleRate: 1,
+		RedactHeaders:     DefaultRedactHeaders,
+		RequestIDHeader:   DefaultRequestIDHeader,
+	}
+}
+
+type requestIDCtxKey struct{}
+
+// RequestID returns the request id set by the middleware, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// Middleware returns a middleware that logs every request handled by the
+// next handler. A nil `config` means `NewConfig(nil)`.
+//
+// The next handler gets a request-scoped child logger, with the request id,
+// method and path, through `logging.FromContext(r.Context())`. In
+// flight-recorder mode the child gets its own buffer, see
+// `logging.Logger.ForkFlightRecorder`.
+func Middleware(config *Config) func(http.Handler) http.Handler {
+	if config == nil {
+		config = NewConfig(nil)
+	}
+	redact := make(map[string]bool, len(config.RedactHeaders))
+	for _, h := range config.RedactHeaders {
+		redact[http.CanonicalHeaderKey(h)] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			logger := config.Logger
+			if logger == nil {
+				logger = logging.GLogger()
+			}
+			var id string
+			if config.RequestIDHeader != "" {
+				if id = r.Header.Get(config.RequestIDHeader); id == "" {
+					id = newRequestID()
+				}
+				w.Header().Set(config.RequestIDHeader, id)
+			}
+			logger = logger.ForkFlightRecorder().With(
+				logging.String("request_id", id),
+				logging.String("method", r.Method),
+				logging.String("path", r.URL.Path),
+			)
+
+			var reqBody *limitedBuffer
+			if config.MaxRequestBody > 0 && r.Body != nil && r.Body != http.NoBody {
+				reqBody = &limitedBuffer{limit: config.MaxRequestBody}
+				r.Body = &teeReadCloser{Reader: io.TeeReader(r.Body, reqBody), Closer: r.Body}
+			}
+			rw := &responseWriter{ResponseWriter: w}
+			if config.MaxResponseBody > 0 {
+				rw.body = &limitedBuffer{limit: config.MaxResponseBody}
+			}
+
+			ctx := context.WithValue(r.Context(), requestIDCtxKey{}, id)
+			ctx = logging.NewContext(ctx, logger)
+			next.ServeHTTP(rw, r.WithContext(ctx))
+
+			if rw.status == 0 {
+				rw.status = http.StatusOK
+			}
+			level, ok := config.Levels[rw.status/100]
+			if !ok || (rw.status/100 == 2 && !sampled(config.SuccessSampleRate)) {
+				return
+			}
+
+			fields := []logging.Field{
+				logging.Int("status", rw.status),
+				logging.Int64("size", rw.size),
+				logging.Duration("latency", time.Since(start)),
+				logging.String("remote_addr", r.RemoteAddr),
+			}
+			if r.URL.RawQuery != "" {
+				fields = append(fields, logging.String("query", r.URL.RawQuery))
+			}
+			if config.LogHeaders {
+				fields = append(fields, logging.Any("headers", redactHeaders(r.Header, redact)))
+			}
+			if reqBody != nil {
+				fields = append(fields, reqBody.field("request_body"))
+			}
+			if rw.body != nil {
+				fields = append(fields, rw.body.field("response_body"))
+			}
+			logger.LogT(level, "http request", fields...)
+		})
+	}
+}
+
+func sampled(rate float64) bool {
+	return rate >= 1 || (rate > 0 && mrand.Float64() < rate)
+}
+
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+func redactHeaders(header http.Header, redact map[string]bool) map[string]string {
+	headers := make(map[string]string, len(header))
+	for k, v := range header {
+		if redact[k] {
+			headers[k] = redacted
+			continue
+		}
+		headers[k] = strings.Join(v, ", ")
+	}
+	return headers
+}
+
+// limitedBuffer keeps the first `limit` bytes written to it.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.truncated = true
+		b.Buffer.Write(p[:room])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+func (b *limitedBuffer) field(key string) logging.Field {
+	if b.truncated {
+		return logging.String(key, b.String()+"...")
+	}
+	return logging.String(key, b.String())
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// responseWriter records the status, the size and the beginning of the body.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+	body   *limitedBuffer
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.size += int64(n)
+	if w.body != nil {
+		_, _ = w.body.Write(p[:n])
+	}
+	return n, err
+}
+
+// Flush implements `http.Flusher` if the underlying writer does.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements `http.Hijacker` if the underlying writer does.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		if w.status == 0 {
+			w.status = http.StatusSwitchingProtocols
+		}
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("http.Hijacker is not supported by the response writer")
+}
@@ -0,0 +1,98 @@
+package httplog
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kisunSea/gopkg/logging"
+)
+
+func newTestLogger(t *testing.T) (*logging.Logger, func() string) {
+	file := filepath.Join(t.TempDir(), "access.log")
+	logger, err := logging.NewLogger(logging.DebugLevel, logging.FatalLevel, "access", "", false,
+		logging.EncodeJson, logging.NewRotateWriter(logging.DebugLevel, file, 1, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logger, func() string {
+		_ = logger.Sync()
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	logger, output := newTestLogger(t)
+	config := NewConfig(logger)
+	config.LogHeaders = true
+	config.MaxRequestBody = 5
+	config.MaxResponseBody = 64
+
+	handler := Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		logging.FromContext(r.Context()).Info("handling " + string(body))
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("not found"))
+	}))
+
+	req := httptest.NewRequest("POST", "/users?id=1", strings.NewReader("payload"))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Request-Id", "req-1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("X-Request-Id") != "req-1" {
+		t.Errorf("request id not sent back: %q", rec.Header().Get("X-Request-Id"))
+	}
+	lines := strings.Split(strings.TrimSpace(output()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", lines)
+	}
+	if !strings.Contains(lines[0], `"message":"handling payload"`) || !strings.Contains(lines[0], `"request_id":"req-1"`) {
+		t.Errorf("request-scoped logger not used: %s", lines[0])
+	}
+	for _, want := range []string{
+		`"level":"WARN"`, `"request_id":"req-1"`, `"method":"POST"`, `"path":"/users"`, `"query":"id=1"`,
+		`"status":404`, `"size":9`, `"latency":`, `"remote_addr":"192.0.2.1:1234"`,
+		`"Authorization":"[REDACTED]"`, `"request_body":"paylo..."`, `"response_body":"not found"`,
+	} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("%s not found in %s", want, lines[1])
+		}
+	}
+	if strings.Contains(lines[1], "secret") {
+		t.Errorf("redacted header logged: %s", lines[1])
+	}
+}
+
+func TestMiddlewareSampling(t *testing.T) {
+	logger, output := newTestLogger(t)
+	config := NewConfig(logger)
+	config.SuccessSampleRate = 0
+
+	var ids []string
+	handler := Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, RequestID(r.Context()))
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	for _, path := range []string{"/ok", "/ok", "/fail"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	lines := strings.Split(strings.TrimSpace(output()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"status":500`) || !strings.Contains(lines[0], `"level":"ERROR"`) {
+		t.Errorf("expected only the 5xx response, got %q", lines)
+	}
+	if len(ids) != 3 || ids[0] == "" || ids[0] == ids[1] {
+		t.Errorf("expected generated request ids, got %q", ids)
+	}
+}
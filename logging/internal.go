@@ -1,12 +1,12 @@
 package logging
 
-import "go.uber.org/zap/zapcore"
-
+// __convertStr2Level panics on invalid levels, `ValidateConf` reports them before.
 func __convertStr2Level(levelStr string) Level {
-	if err := __l.Set(levelStr); err != nil {
+	level, err := parseLevel(levelStr)
+	if err != nil {
 		panic(err)
 	}
-	return __l.Get().(zapcore.Level)
+	return level
 }
 
 func __in(target string, origin []string) bool {
@@ -2,6 +2,7 @@ package logging
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -48,12 +49,15 @@ const (
 )
 
 type Logger struct {
+	name_      string
 	baseLogger *zap.Logger
 	sLogger    *zap.SugaredLogger
 	config_    zapcore.EncoderConfig
 	level_     zapcore.Level
 	format_    Encoder
 	handlers   []handler
+	recorder   *flightRecorder
+	stats      *loggerStats
 }
 
 ////////////////////////////////////////////
@@ -122,7 +126,9 @@ func NewLogger(
 	writers ...interface{}) (logger *Logger, err error) {
 
 	logger = new(Logger)
+	logger.name_ = prefix
 	logger.level_ = level
+	logger.stats = new(loggerStats)
 
 	if timeFormat == "" {
 		timeFormat = "2006/01/02 - 15:04:05.000"
@@ -163,10 +169,13 @@ func (l *Logger) initHandlers() {
 	l.handlers = make([]handler, 0)
 }
 
-func (l *Logger) addHandler(sync zapcore.WriteSyncer, lowLevel zapcore.Level) {
+func (l *Logger) addHandler(name string, sync zapcore.WriteSyncer, lowLevel zapcore.Level, stats *handlerStats, closer io.Closer) {
 	l.handlers = append(l.handlers, handler{
+		Name:       name,
 		Sync:       sync,
 		EnableFunc: func(lev zapcore.Level) bool { return lev >= lowLevel },
+		stats:      stats,
+		closer:     closer,
 	})
 }
 
@@ -174,7 +183,8 @@ func (l *Logger) setWriters(writers []interface{}) (err error) {
 
 	defer func() {
 		if len(l.handlers) == 0 {
-			l.addHandler(zapcore.AddSync(os.Stdout), DebugLevel)
+			stats := new(handlerStats)
+			l.addHandler("stdout", newMeteredSyncer(zapcore.AddSync(os.Stdout), stats, nil), DebugLevel, stats, nil)
 		}
 	}()
 
@@ -191,6 +201,9 @@ func (l *Logger) bindHandler(writer interface{}) (err error) {
 	var (
 		sync__     zapcore.WriteSyncer
 		lowLevel__ Level
+		name__     string
+		stats__    = new(handlerStats)
+		closer__   io.Closer
 	)
 
 	switch i := writer.(type) {
@@ -202,15 +215,41 @@ func (l *Logger) bindHandler(writer interface{}) (err error) {
 		lumberJackLogger := NewLumberjackFileRotatingLogger(i.Level, i.LogSavePath, i.MaxSize, i.MaxBackups, i.MaxAge)
 		sync__, lowLevel__ = zapcore.AddSync(lumberJackLogger), i.Level
 		zapcore.Lock(sync__)
+		name__, closer__ = lumberJackLogger.Filename, lumberJackLogger
+		sync__ = newMeteredSyncer(sync__, stats__, lumberJackLogger)
+		if len(i.EncryptKey) > 0 {
+			if sync__, err = newEncryptSyncer(sync__, i.EncryptKeyID, i.EncryptKey); err != nil {
+				return err
+			}
+		}
+		break
+	case *auditWriter:
+		if err = MkdirAllUtilSuccess(filepath.Dir(i.LogSavePath), 10); err != nil {
+			return err
+		}
+		// the audit log keeps its name for `VerifyAuditLog`, and its backups are
+		// removed by auditSyncer which moves the anchor of the chain first.
+		lumberJackLogger := &lumberjack.Logger{Filename: i.LogSavePath, MaxSize: i.MaxSize}
+		name__, closer__ = lumberJackLogger.Filename, lumberJackLogger
+		metered := newMeteredSyncer(zapcore.AddSync(lumberJackLogger), stats__, lumberJackLogger)
+		// auditSyncer serializes writes itself, the chain must follow the order on disk.
+		var audit *auditSyncer
+		if audit, err = newAuditSyncer(metered, lumberJackLogger.Filename, i); err != nil {
+			return err
+		}
+		metered.onRotate = audit.rotated
+		sync__, lowLevel__ = audit, i.Level
 		break
 	case *consoleWriter:
 		sync__, lowLevel__ = zapcore.AddSync(os.Stdout), i.Level
+		name__ = "stdout"
+		sync__ = newMeteredSyncer(sync__, stats__, nil)
 		break
 	default:
 		return fmt.Errorf("unsupported writer: %T", i)
 	}
 
-	l.addHandler(sync__, lowLevel__)
+	l.addHandler(name__, sync__, lowLevel__, stats__, closer__)
 	return nil
 }
 
@@ -221,28 +260,41 @@ func (l *Logger) GetAndBuildCore(config zapcore.EncoderConfig) zapcore.Core {
 		panic("why handlers is nil ???")
 	}
 
+	if l.stats == nil {
+		l.stats = new(loggerStats)
+	}
+
 	var cores []zapcore.Core
 	for _, handler := range l.handlers {
-		var tmpEncoder zapcore.Encoder
-		switch l.format_ {
-		case EncodeJson:
-			tmpEncoder = zapcore.NewJSONEncoder(config)
-		case EncodeConsole:
-			fallthrough
-		default:
-			tmpEncoder = zapcore.NewConsoleEncoder(config)
-		}
+		cores = append(cores, &meteredCore{
+			Core:  zapcore.NewCore(l.newEncoder(config), zapcore.NewMultiWriteSyncer(handler.Sync), handler.EnableFunc),
+			stats: handler.stats,
+		})
+	}
 
-		cores = append(cores,
-			zapcore.NewCore(tmpEncoder, zapcore.NewMultiWriteSyncer(handler.Sync), handler.EnableFunc))
+	// shutdownCore comes last, `Fatal` shuts down once the entry is written
+	core := zapcore.NewTee(&loggerCore{Core: zapcore.NewTee(cores...), stats: l.stats}, shutdownCore{})
+	if l.recorder != nil {
+		core = l.recorder.wrap(core, l.newEncoder(config), l.handlers)
 	}
+	return core
+}
 
-	return zapcore.NewTee(cores...)
+func (l *Logger) newEncoder(config zapcore.EncoderConfig) zapcore.Encoder {
+	switch l.format_ {
+	case EncodeJson:
+		return zapcore.NewJSONEncoder(config)
+	case EncodeConsole:
+		fallthrough
+	default:
+		return zapcore.NewConsoleEncoder(config)
+	}
 }
 
 func (l *Logger) CloseStacktrace() *Logger {
 	c := l.config_
 	c.StacktraceKey = ""
+	l.config_ = c
 	l.baseLogger = l.WrapCore(c)
 	l.sugared()
 	return l
@@ -256,6 +308,7 @@ func (l *Logger) SetStacktrace(level Level) *Logger {
 func (l *Logger) NoColor() *Logger {
 	c := l.config_
 	c.EncodeLevel = zapcore.CapitalLevelEncoder
+	l.config_ = c
 	l.baseLogger = l.WrapCore(c)
 	return l
 }
@@ -267,6 +320,7 @@ func (l *Logger) SetTimeFormat(timeFormat string) *Logger {
 	c.EncodeTime = func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 		enc.AppendString(t.Format(timeFormat))
 	}
+	l.config_ = c
 
 	l.baseLogger = l.WrapCore(c)
 	l.sugared()
@@ -0,0 +1,338 @@
+package logging
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// metrics ...
+//
+// Every logger counts the entries it accepts by level and the flight-recorder
+// entries it drops, every handler counts the entries and bytes it writes, its
+// write errors (the entry is dropped) and its file rotations. `Stats` returns
+// a snapshot, `MetricsHandler` serves them in the Prometheus text format.
+
+const (
+	_levelCount = int(FatalLevel-DebugLevel) + 1
+	_megabyte   = 1024 * 1024
+
+	// lumberjack rotates at 100 megabytes when MaxSize is 0
+	lumberjackDefaultMaxSize = 100
+)
+
+var _registry struct {
+	sync.Mutex
+	loggers []*Logger
+}
+
+// Register adds `l` to the loggers reported by `Stats` and closed by `Shutdown`,
+// until `l.Close()`. The loggers of `SetConf` and the global logger are
+// registered, the other loggers of `NewLogger` are not, so that the loggers
+// built per tenant or per job are not pinned.
+func Register(l *Logger) {
+	_registry.Lock()
+	defer _registry.Unlock()
+	for _, r := range _registry.loggers {
+		if r == l {
+			return
+		}
+	}
+	_registry.loggers = append(_registry.loggers, l)
+}
+
+// unregisterLogger removes `l` from the registry, it is called when `l` is closed.
+func unregisterLogger(l *Logger) {
+	_registry.Lock()
+	defer _registry.Unlock()
+	for i, r := range _registry.loggers {
+		if r == l {
+			copy(_registry.loggers[i:], _registry.loggers[i+1:])
+			_registry.loggers[len(_registry.loggers)-1] = nil
+			_registry.loggers = _registry.loggers[:len(_registry.loggers)-1]
+			return
+		}
+	}
+}
+
+func registeredLoggers() []*Logger {
+	_registry.Lock()
+	defer _registry.Unlock()
+	return append([]*Logger(nil), _registry.loggers...)
+}
+
+type levelCounters [_levelCount]uint64
+
+func (c *levelCounters) incr(level Level) {
+	if i := int(level - DebugLevel); i >= 0 && i < _levelCount {
+		atomic.AddUint64(&c[i], 1)
+	}
+}
+
+func (c *levelCounters) snapshot() map[string]uint64 {
+	m := make(map[string]uint64, _levelCount)
+	for i := range c {
+		m[(DebugLevel + Level(i)).String()] = atomic.LoadUint64(&c[i])
+	}
+	return m
+}
+
+type loggerStats struct {
+	entries levelCounters
+	dropped uint64
+}
+
+type handlerStats struct {
+	entries     levelCounters
+	bytes       uint64
+	writeErrors uint64
+	dropped     uint64
+	rotations   uint64
+}
+
+// LoggerStats is a snapshot of the counters of a logger.
+type LoggerStats struct {
+	Name string
+	// Entries accepted by at least one handler, by level
+	Entries map[string]uint64
+	// Dropped entries, buffered by the flight recorder and evicted before any error dumped them
+	Dropped  uint64
+	Handlers []HandlerStats
+}
+
+// HandlerStats is a snapshot of the counters of a handler.
+type HandlerStats struct {
+	Name        string
+	Entries     map[string]uint64
+	Bytes       uint64
+	WriteErrors uint64
+	// Dropped entries, lost because of write errors
+	Dropped   uint64
+	Rotations uint64
+}
+
+// Stats returns a snapshot of the counters of `l`, children created by `With`
+// share the counters of their parent.
+func (l *Logger) Stats() LoggerStats {
+	s := LoggerStats{
+		Name:     l.name_,
+		Entries:  l.stats.entries.snapshot(),
+		Dropped:  atomic.LoadUint64(&l.stats.dropped),
+		Handlers: make([]HandlerStats, 0, len(l.handlers)),
+	}
+	for _, h := range l.handlers {
+		s.Handlers = append(s.Handlers, HandlerStats{
+			Name:        h.Name,
+			Entries:     h.stats.entries.snapshot(),
+			Bytes:       atomic.LoadUint64(&h.stats.bytes),
+			WriteErrors: atomic.LoadUint64(&h.stats.writeErrors),
+			Dropped:     atomic.LoadUint64(&h.stats.dropped),
+			Rotations:   atomic.LoadUint64(&h.stats.rotations),
+		})
+	}
+	return s
+}
+
+// Stats returns the snapshots of the registered loggers, see `Register`.
+func Stats() []LoggerStats {
+	loggers := registeredLoggers()
+	stats := make([]LoggerStats, 0, len(loggers))
+	for _, l := range loggers {
+		stats = append(stats, l.Stats())
+	}
+	return stats
+}
+
+// MetricsHandler returns a `http.Handler` that serves `Stats()` in the
+// Prometheus text exposition format.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = WritePrometheus(w)
+	})
+}
+
+// WritePrometheus writes `Stats()` to `w` in the Prometheus text exposition format.
+func WritePrometheus(w io.Writer) error {
+	stats := Stats()
+
+	// loggers may share a name, keep their series apart
+	seen := make(map[string]int)
+	for i := range stats {
+		name := stats[i].Name
+		if seen[name]++; seen[name] > 1 {
+			stats[i].Name = fmt.Sprintf("%s#%d", name, seen[name])
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	metric := func(name, help string, each func(s *LoggerStats)) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for i := range stats {
+			each(&stats[i])
+		}
+	}
+	levels := func(name, labels string, entries map[string]uint64) {
+		for i := 0; i < _levelCount; i++ {
+			level := (DebugLevel + Level(i)).String()
+			fmt.Fprintf(bw, "%s{%s,level=\"%s\"} %d\n", name, labels, level, entries[level])
+		}
+	}
+	handlers := func(name string, value func(h *HandlerStats) uint64) func(s *LoggerStats) {
+		return func(s *LoggerStats) {
+			for j := range s.Handlers {
+				fmt.Fprintf(bw, "%s{%s} %d\n", name, handlerLabels(s, &s.Handlers[j]), value(&s.Handlers[j]))
+			}
+		}
+	}
+
+	metric("gopkg_logging_entries_total", "Log entries accepted by the logger, by level.", func(s *LoggerStats) {
+		levels("gopkg_logging_entries_total", loggerLabels(s), s.Entries)
+	})
+	metric("gopkg_logging_dropped_entries_total", "Flight-recorder entries evicted before being written.", func(s *LoggerStats) {
+		fmt.Fprintf(bw, "gopkg_logging_dropped_entries_total{%s} %d\n", loggerLabels(s), s.Dropped)
+	})
+	metric("gopkg_logging_handler_entries_total", "Log entries written by the handler, by level.", func(s *LoggerStats) {
+		for j := range s.Handlers {
+			levels("gopkg_logging_handler_entries_total", handlerLabels(s, &s.Handlers[j]), s.Handlers[j].Entries)
+		}
+	})
+	metric("gopkg_logging_handler_bytes_written_total", "Bytes written by the handler.",
+		handlers("gopkg_logging_handler_bytes_written_total", func(h *HandlerStats) uint64 { return h.Bytes }))
+	metric("gopkg_logging_handler_write_errors_total", "Failed writes of the handler.",
+		handlers("gopkg_logging_handler_write_errors_total", func(h *HandlerStats) uint64 { return h.WriteErrors }))
+	metric("gopkg_logging_handler_dropped_entries_total", "Log entries lost by the handler because of write errors.",
+		handlers("gopkg_logging_handler_dropped_entries_total", func(h *HandlerStats) uint64 { return h.Dropped }))
+	metric("gopkg_logging_handler_rotations_total", "Log file rotations of the handler.",
+		handlers("gopkg_logging_handler_rotations_total", func(h *HandlerStats) uint64 { return h.Rotations }))
+
+	return bw.Flush()
+}
+
+var _labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func loggerLabels(s *LoggerStats) string {
+	return `logger="` + _labelEscaper.Replace(s.Name) + `"`
+}
+
+func handlerLabels(s *LoggerStats, h *HandlerStats) string {
+	return loggerLabels(s) + `,handler="` + _labelEscaper.Replace(h.Name) + `"`
+}
+
+// loggerCore counts the entries accepted by any of the handler cores it tees.
+type loggerCore struct {
+	zapcore.Core
+	stats *loggerStats
+}
+
+func (c *loggerCore) With(fields []zapcore.Field) zapcore.Core {
+	return &loggerCore{Core: c.Core.With(fields), stats: c.stats}
+}
+
+func (c *loggerCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Core.Enabled(ent.Level) {
+		c.stats.entries.incr(ent.Level)
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// meteredCore counts the entries written, or dropped, by a handler.
+type meteredCore struct {
+	zapcore.Core
+	stats *handlerStats
+}
+
+func (c *meteredCore) With(fields []zapcore.Field) zapcore.Core {
+	return &meteredCore{Core: c.Core.With(fields), stats: c.stats}
+}
+
+func (c *meteredCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *meteredCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if err := c.Core.Write(ent, fields); err != nil {
+		atomic.AddUint64(&c.stats.dropped, 1)
+		return err
+	}
+	c.stats.entries.incr(ent.Level)
+	return nil
+}
+
+// meteredSyncer counts the bytes and errors of the underlying writer, and the
+// rotations of `rotate`. It follows the size of the file from the bytes it
+// writes, and only states the file when the size goes past `MaxSize`, which is
+// when lumberjack rotates it: a new file means that it was rotated.
+type meteredSyncer struct {
+	zapcore.WriteSyncer
+	stats *handlerStats
+
+	rotate   *lumberjack.Logger
+	max      int64
+	size     int64 // the size of the file, updated atomically
+	mu       sync.Mutex
+	file     os.FileInfo // the file stated last, nil if it did not exist yet
+	stated   int32       // 1 once `file` is known, set atomically
+	onRotate func()      // called after the write that rotated the file, if any
+}
+
+func newMeteredSyncer(out zapcore.WriteSyncer, stats *handlerStats, rotate *lumberjack.Logger) *meteredSyncer {
+	m := &meteredSyncer{WriteSyncer: out, stats: stats, rotate: rotate}
+	if rotate != nil {
+		m.max = int64(rotate.MaxSize) * _megabyte
+		if m.max == 0 {
+			m.max = lumberjackDefaultMaxSize * _megabyte
+		}
+		// lumberjack may rotate the existing file at the first write
+		if m.file, _ = os.Stat(rotate.Filename); m.file != nil {
+			m.size, m.stated = m.file.Size(), 1
+		}
+	}
+	return m
+}
+
+func (m *meteredSyncer) Write(p []byte) (n int, err error) {
+	n, err = m.WriteSyncer.Write(p)
+	atomic.AddUint64(&m.stats.bytes, uint64(n))
+	if err != nil {
+		atomic.AddUint64(&m.stats.writeErrors, 1)
+	}
+	if m.rotate != nil {
+		// the file created by the first write is stated once
+		if atomic.AddInt64(&m.size, int64(n)) > m.max || atomic.LoadInt32(&m.stated) == 0 {
+			m.observeFile()
+		}
+	}
+	return n, err
+}
+
+// observeFile counts a rotation if the file changed since it was stated last,
+// and resyncs the size with the file.
+func (m *meteredSyncer) observeFile() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	info, err := os.Stat(m.rotate.Filename)
+	if err != nil {
+		return
+	}
+	atomic.StoreInt64(&m.size, info.Size())
+	if m.file != nil && !os.SameFile(m.file, info) {
+		atomic.AddUint64(&m.stats.rotations, 1)
+		if m.onRotate != nil {
+			m.onRotate()
+		}
+	}
+	m.file = info
+	atomic.StoreInt32(&m.stated, 1)
+}
@@ -0,0 +1,163 @@
+package logging
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingSyncer fails every write.
+type failingSyncer struct{}
+
+func (failingSyncer) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func (failingSyncer) Sync() error { return nil }
+
+func TestLoggerStats(t *testing.T) {
+	out := new(syncBuffer)
+	logger := newTestLogger(t, EncodeConsole, InfoLevel, out)
+
+	logger.Debug("skipped")
+	logger.Info("info")
+	logger.With(String("k", "v")).InfoT("info with fields")
+	logger.Warn("warn")
+	logger.Error("error")
+
+	s := logger.Stats()
+	if s.Name != t.Name() {
+		t.Errorf("unexpected name %q", s.Name)
+	}
+	if s.Entries["debug"] != 0 || s.Entries["info"] != 2 || s.Entries["warn"] != 1 || s.Entries["error"] != 1 {
+		t.Errorf("unexpected logger entries %v", s.Entries)
+	}
+	if len(s.Handlers) != 1 {
+		t.Fatalf("expected 1 handler, got %d", len(s.Handlers))
+	}
+	h := s.Handlers[0]
+	if h.Entries["info"] != 2 || h.Entries["error"] != 1 {
+		t.Errorf("unexpected handler entries %v", h.Entries)
+	}
+	if h.Bytes != uint64(len(out.String())) {
+		t.Errorf("expected %d bytes, got %d", len(out.String()), h.Bytes)
+	}
+	if h.WriteErrors != 0 || h.Dropped != 0 {
+		t.Errorf("unexpected errors %d, dropped %d", h.WriteErrors, h.Dropped)
+	}
+}
+
+func TestLoggerStatsWriteErrors(t *testing.T) {
+	logger := newTestLogger(t, EncodeConsole, DebugLevel, failingSyncer{})
+	logger.Info("lost")
+	logger.Info("lost again")
+
+	h := logger.Stats().Handlers[0]
+	if h.WriteErrors != 2 || h.Dropped != 2 {
+		t.Errorf("expected 2 write errors and 2 dropped entries, got %d and %d", h.WriteErrors, h.Dropped)
+	}
+	if h.Entries["info"] != 0 {
+		t.Errorf("dropped entries counted as written: %v", h.Entries)
+	}
+}
+
+func TestLoggerStatsRotations(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rotate.log")
+	logger, err := NewLogger(DebugLevel, ErrorLevel, "rotate", "", false, EncodeConsole,
+		NewRotateWriter(DebugLevel, file, 1, 5, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// count the new files seen between the writes, whatever their backups are named
+	var (
+		line      = strings.Repeat("x", 64<<10)
+		last      os.FileInfo
+		rotations uint64
+	)
+	for i := 0; i < 40; i++ {
+		logger.Info(line)
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last != nil && !os.SameFile(last, info) {
+			rotations++
+		}
+		last = info
+	}
+
+	h := logger.Stats().Handlers[0]
+	if h.Name != file {
+		t.Errorf("unexpected handler name %q", h.Name)
+	}
+	if rotations == 0 || h.Rotations != rotations {
+		t.Errorf("expected %d rotations, got %d", rotations, h.Rotations)
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	logger, err := NewLogger(DebugLevel, ErrorLevel, "closed", "", false, EncodeConsole,
+		NewRotateWriter(DebugLevel, filepath.Join(t.TempDir(), "closed.log"), 1, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered := func() bool {
+		for _, l := range registeredLoggers() {
+			if l == logger {
+				return true
+			}
+		}
+		return false
+	}
+	// loggers are not pinned unless registered
+	if registered() {
+		t.Fatal("logger registered by NewLogger")
+	}
+	Register(logger)
+	Register(logger)
+	if !registered() {
+		t.Fatal("logger not registered")
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if registered() {
+		t.Error("closed logger still registered")
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	logger, err := NewLogger(DebugLevel, ErrorLevel, "metrics", "", false, EncodeConsole,
+		NewRotateWriter(InfoLevel, filepath.Join(t.TempDir(), "metrics.log"), 1, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Register(logger)
+	defer logger.Close()
+	logger.Info("info")
+	logger.Warn("warn")
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{
+		"# TYPE gopkg_logging_entries_total counter",
+		`gopkg_logging_entries_total{logger="metrics",level="info"} 1`,
+		`gopkg_logging_entries_total{logger="metrics",level="warn"} 1`,
+		`gopkg_logging_dropped_entries_total{logger="metrics"} 0`,
+		`gopkg_logging_handler_rotations_total{logger="metrics",handler="`,
+		"# TYPE gopkg_logging_handler_bytes_written_total counter",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("%q not found in:\n%s", want, body)
+		}
+	}
+}
@@ -5,6 +5,10 @@ var (
 	defaultLogger, _ = NewConsoleStreamingLogger("go-pkg", DebugLevel, WarnLevel, DebugLevel)
 )
 
+func init() {
+	Register(defaultLogger)
+}
+
 // GLogger returns the global logger in `go-pkg`
 func GLogger() (logger_ *Logger) {
 	return defaultLogger
@@ -13,6 +17,7 @@ func GLogger() (logger_ *Logger) {
 // ReplaceGlobalLogger can replace the default logger with custom logger
 func ReplaceGlobalLogger(newLogger *Logger) {
 	defaultLogger = newLogger
+	Register(newLogger)
 }
 
 // NewFileRotatingLogger returns logging instance by rotating file.
@@ -3,7 +3,6 @@ package logging
 import (
 	"gopkg.in/ini.v1"
 	"strconv"
-	"strings"
 )
 
 // parser ...
@@ -24,6 +23,9 @@ const (
 	SectionHandlerValMaxSize    = "max_size"
 	SectionHandlerValMaxBackups = "max_backups"
 	SectionHandlerValLogFile    = "log_file"
+	SectionHandlerValKeyFile    = "encrypt_key_file"
+	SectionHandlerValKeyEnv     = "encrypt_key_env"
+	SectionHandlerValKeyID      = "encrypt_key_id"
 
 	ClassRotateFile = "logging.NewFileRotatingLogger"
 	ClassConsole    = "logging.NewConsoleStreamingLogger"
@@ -45,13 +47,13 @@ func NewConfParser(conf string) (c *confParser, err error) {
 }
 
 func (c *confParser) LoggerKeys() []string {
-	return strings.Split(
-		__getCfgKey(c.iniFp, SectionLoggers, SectionLoggersValKeys), ",")
+	return splitConfList(
+		__getCfgKey(c.iniFp, SectionLoggers, SectionLoggersValKeys))
 }
 
 func (c *confParser) HandlerKeys() []string {
-	return strings.Split(
-		__getCfgKey(c.iniFp, SectionHandlers, SectionHandlersValKeys), ",")
+	return splitConfList(
+		__getCfgKey(c.iniFp, SectionHandlers, SectionHandlersValKeys))
 }
 
 func (c *confParser) ValLoggerLevel(loggerKey string) Level {
@@ -65,8 +67,8 @@ func (c *confParser) ValLoggerStackLevel(loggerKey string) Level {
 }
 
 func (c *confParser) ValLoggerHandler(loggerKey string) []string {
-	return strings.Split(
-		__getCfgKey(c.iniFp, SectionLoggerPrefix+loggerKey, SectionLoggerValHandler), ",")
+	return splitConfList(
+		__getCfgKey(c.iniFp, SectionLoggerPrefix+loggerKey, SectionLoggerValHandler))
 }
 
 func (c *confParser) ValHandlerLogFile(handlerKey string) string {
@@ -106,6 +108,18 @@ func (c *confParser) ValHandlerMaxBackups(handlerKey string) int {
 	return 0
 }
 
+func (c *confParser) ValHandlerEncryptKeyFile(handlerKey string) string {
+	return __getCfgKey(c.iniFp, SectionHandlerPrefix+handlerKey, SectionHandlerValKeyFile)
+}
+
+func (c *confParser) ValHandlerEncryptKeyEnv(handlerKey string) string {
+	return __getCfgKey(c.iniFp, SectionHandlerPrefix+handlerKey, SectionHandlerValKeyEnv)
+}
+
+func (c *confParser) ValHandlerEncryptKeyID(handlerKey string) string {
+	return __getCfgKey(c.iniFp, SectionHandlerPrefix+handlerKey, SectionHandlerValKeyID)
+}
+
 func __getCfgKey(__cfg *ini.File, section, key string) string {
 	return __cfg.Section(section).Key(key).String()
 }
@@ -0,0 +1,255 @@
+package logging
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// recorder ...
+//
+// In flight-recorder mode, entries that no handler would write (debug entries
+// of a logger running at info level, typically) are encoded into a ring buffer
+// instead of being discarded. When an entry at the trigger level is logged, the
+// buffered entries are written to its handlers just before it, so the error
+// comes with the debug context that led to it.
+
+const (
+	defaultRecorderWindow   = 256
+	defaultRecorderMaxBytes = 1 << 20
+)
+
+// FlightRecorderConfig configures the flight-recorder mode of a logger.
+type FlightRecorderConfig struct {
+	// Window is the maximum number of buffered entries
+	Window int
+	// MaxBytes is the maximum size of buffered entries, the oldest entries are
+	// evicted first
+	MaxBytes int
+	// Trigger is the lowest level that dumps the buffered entries
+	Trigger Level
+}
+
+// NewFlightRecorderConfig returns the default flight-recorder configuration.
+func NewFlightRecorderConfig() *FlightRecorderConfig {
+	return &FlightRecorderConfig{
+		Window:   defaultRecorderWindow,
+		MaxBytes: defaultRecorderMaxBytes,
+		Trigger:  ErrorLevel,
+	}
+}
+
+// EnableFlightRecorder buffers the entries discarded by all handlers of `l`,
+// and dumps them when an entry at `config.Trigger` or above is logged. The
+// buffer is shared by `l` and its children, use `ForkFlightRecorder` to get a
+// buffer per request. A nil `config` means `NewFlightRecorderConfig()`.
+func (l *Logger) EnableFlightRecorder(config *FlightRecorderConfig) *Logger {
+	if config == nil {
+		config = NewFlightRecorderConfig()
+	}
+	if l.recorder != nil {
+		l.recorder.reset(config)
+		return l
+	}
+
+	l.recorder = newFlightRecorder(config, l.stats)
+	l.baseLogger = l.baseLogger.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return l.recorder.wrap(c, l.newEncoder(l.config_), l.handlers)
+	}))
+	l.sLogger = l.baseLogger.Sugar()
+	return l
+}
+
+// ForkFlightRecorder returns a child logger with its own, empty flight-recorder
+// buffer, e.g. one per request, so that an error only dumps its own context.
+// It returns `l` itself if the flight-recorder mode is not enabled.
+func (l *Logger) ForkFlightRecorder() *Logger {
+	if l.recorder == nil {
+		return l
+	}
+	child := *l
+	child.recorder = newFlightRecorder(l.recorder.config(), l.stats)
+	child.baseLogger = l.baseLogger.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		if rc, ok := c.(*recorderCore); ok {
+			return rc.withRecorder(child.recorder)
+		}
+		return c
+	}))
+	child.sLogger = child.baseLogger.Sugar()
+	return &child
+}
+
+type recordedEntry struct {
+	level Level
+	bytes []byte
+}
+
+type flightRecorder struct {
+	mu       sync.Mutex
+	window   int
+	maxBytes int
+	trigger  Level
+	entries  []recordedEntry // ring buffer, the oldest entry is at `head`
+	head     int
+	n        int
+	bytes    int
+	stats    *loggerStats // evicted entries are counted as dropped
+}
+
+func newFlightRecorder(config *FlightRecorderConfig, stats *loggerStats) *flightRecorder {
+	r := &flightRecorder{stats: stats}
+	r.reset(config)
+	return r
+}
+
+func (r *flightRecorder) reset(config *FlightRecorderConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.window, r.maxBytes, r.trigger = config.Window, config.MaxBytes, config.Trigger
+	if r.window <= 0 {
+		r.window = defaultRecorderWindow
+	}
+	if r.maxBytes <= 0 {
+		r.maxBytes = defaultRecorderMaxBytes
+	}
+	r.entries = make([]recordedEntry, r.window)
+	r.head, r.n, r.bytes = 0, 0, 0
+}
+
+func (r *flightRecorder) config() *FlightRecorderConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &FlightRecorderConfig{Window: r.window, MaxBytes: r.maxBytes, Trigger: r.trigger}
+}
+
+func (r *flightRecorder) triggerLevel() Level {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.trigger
+}
+
+func (r *flightRecorder) push(entry recordedEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(entry.bytes) > r.maxBytes {
+		r.drop()
+		return
+	}
+	for r.n == r.window || r.bytes+len(entry.bytes) > r.maxBytes {
+		r.evict()
+		r.drop()
+	}
+	r.entries[(r.head+r.n)%r.window] = entry
+	r.n++
+	r.bytes += len(entry.bytes)
+}
+
+func (r *flightRecorder) evict() {
+	r.bytes -= len(r.entries[r.head].bytes)
+	r.entries[r.head] = recordedEntry{}
+	r.head = (r.head + 1) % r.window
+	r.n--
+}
+
+func (r *flightRecorder) drop() {
+	if r.stats != nil {
+		atomic.AddUint64(&r.stats.dropped, 1)
+	}
+}
+
+// drain returns the buffered entries, oldest first, and empties the buffer.
+func (r *flightRecorder) drain() (entries []recordedEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries = make([]recordedEntry, 0, r.n)
+	for r.n > 0 {
+		entries = append(entries, r.entries[r.head])
+		r.evict()
+	}
+	return entries
+}
+
+func (r *flightRecorder) wrap(core zapcore.Core, enc zapcore.Encoder, handlers []handler) zapcore.Core {
+	return &recorderCore{Core: core, enc: enc, handlers: handlers, recorder: r}
+}
+
+// recorderCore records the entries `Core` does not enable, and dumps them to
+// the handlers before an entry at the trigger level.
+type recorderCore struct {
+	zapcore.Core
+	enc      zapcore.Encoder
+	handlers []handler
+	recorder *flightRecorder
+}
+
+func (c *recorderCore) Enabled(zapcore.Level) bool {
+	return true
+}
+
+func (c *recorderCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.Core = c.Core.With(fields)
+	clone.enc = c.enc.Clone()
+	for i := range fields {
+		fields[i].AddTo(clone.enc)
+	}
+	return &clone
+}
+
+func (c *recorderCore) withRecorder(r *flightRecorder) *recorderCore {
+	clone := *c
+	clone.recorder = r
+	return &clone
+}
+
+func (c *recorderCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level >= c.recorder.triggerLevel() {
+		// added first, so the buffered entries are written before this one
+		return c.Core.Check(ent, ce.AddCore(ent, c))
+	}
+	if c.Core.Enabled(ent.Level) {
+		return c.Core.Check(ent, ce)
+	}
+	return ce.AddCore(ent, c)
+}
+
+func (c *recorderCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Level >= c.recorder.triggerLevel() {
+		return c.dump(ent.Level)
+	}
+
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	entry := recordedEntry{level: ent.Level, bytes: make([]byte, buf.Len())}
+	copy(entry.bytes, buf.Bytes())
+	buf.Free()
+	c.recorder.push(entry)
+	return nil
+}
+
+func (c *recorderCore) dump(level Level) (err error) {
+	entries := c.recorder.drain()
+	if len(entries) == 0 {
+		return nil
+	}
+	for _, h := range c.handlers {
+		if !h.EnableFunc(level) {
+			continue
+		}
+		for _, entry := range entries {
+			if _, werr := h.Sync.Write(entry.bytes); werr != nil {
+				atomic.AddUint64(&h.stats.dropped, 1)
+				if err == nil {
+					err = werr
+				}
+				continue
+			}
+			h.stats.entries.incr(entry.level)
+		}
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFlightRecorder(t *testing.T) {
+	out := new(syncBuffer)
+	logger := newTestLogger(t, EncodeConsole, InfoLevel, out).EnableFlightRecorder(&FlightRecorderConfig{
+		Window:   3,
+		MaxBytes: 1 << 10,
+		Trigger:  ErrorLevel,
+	})
+
+	for i := 0; i < 5; i++ {
+		logger.DebugF("debug %d", i)
+	}
+	logger.Info("info")
+	if strings.Contains(out.String(), "debug") {
+		t.Fatalf("debug entries written before the trigger: %s", out.String())
+	}
+
+	logger.With(String("k", "v")).DebugT("with fields")
+	logger.Error("failure")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{"info", "debug 3", "debug 4", "with fields", "failure"}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, got %q", len(want), lines)
+	}
+	for i, w := range want {
+		if !strings.Contains(lines[i], w) {
+			t.Errorf("line %d: expected %q in %q", i, w, lines[i])
+		}
+	}
+	if !strings.Contains(lines[3], `{"k": "v"}`) {
+		t.Errorf("context fields lost: %q", lines[3])
+	}
+
+	// the buffer is emptied by the dump
+	logger.Error("again")
+	if n := strings.Count(out.String(), "debug"); n != 2 {
+		t.Errorf("expected 2 debug lines, got %d", n)
+	}
+}
+
+func TestFlightRecorderFork(t *testing.T) {
+	out := new(syncBuffer)
+	logger := newTestLogger(t, EncodeConsole, InfoLevel, out).EnableFlightRecorder(nil)
+
+	ctx1 := NewContext(context.Background(), logger.ForkFlightRecorder())
+	ctx2 := NewContext(context.Background(), logger.ForkFlightRecorder())
+	for i := 0; i < 3; i++ {
+		FromContext(ctx1).Debug(fmt.Sprintf("request-1 step %d", i))
+		FromContext(ctx2).Debug(fmt.Sprintf("request-2 step %d", i))
+	}
+	FromContext(ctx2).Error("request-2 failed")
+
+	if strings.Contains(out.String(), "request-1 step") {
+		t.Errorf("unrelated context dumped: %s", out.String())
+	}
+	if n := strings.Count(out.String(), "request-2 step"); n != 3 {
+		t.Errorf("expected 3 buffered lines of request-2, got %d", n)
+	}
+}
+
+func TestFlightRecorderMaxBytes(t *testing.T) {
+	stats := new(loggerStats)
+	r := newFlightRecorder(&FlightRecorderConfig{Window: 10, MaxBytes: 10, Trigger: ErrorLevel}, stats)
+	for _, entry := range []string{"aaaa", "bbbb", "cccc", "this entry is too large"} {
+		r.push(recordedEntry{level: DebugLevel, bytes: []byte(entry)})
+	}
+	entries := r.drain()
+	if len(entries) != 2 || string(entries[0].bytes) != "bbbb" || string(entries[1].bytes) != "cccc" {
+		t.Errorf("unexpected entries %v", entries)
+	}
+	if stats.dropped != 2 {
+		t.Errorf("expected 2 dropped entries, got %d", stats.dropped)
+	}
+}
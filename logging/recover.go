@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/kisunSea/gopkg/runtime/traceback"
+)
+
+const defaultPanicMessage = "panic recovered"
+
+// _exit is replaced in tests
+var _exit = os.Exit
+
+// RecoverOptions controls how `Recover`, `LogPanic` and `Go` handle a panic.
+// A nil *RecoverOptions logs the panic and carries on.
+type RecoverOptions struct {
+	// Message of the log entry, `panic recovered` by default
+	Message string
+	// Fields describe the context of the panic, they are added to the entry
+	Fields []Field
+	// OnPanic is called with the panic value after it has been logged
+	OnPanic func(r interface{})
+	// RePanic panics again with the same value after logging
+	RePanic bool
+	// Exit runs `Shutdown` bounded by `DefaultShutdownTimeout`, so that the
+	// other loggers are flushed too, and then calls `os.Exit(ExitCode)`,
+	// ExitCode 0 means 1
+	Exit     bool
+	ExitCode int
+}
+
+// Recover logs a panic of the calling goroutine with its stack and goroutine
+// id, it must be deferred directly:
+//
+//	defer logging.Recover(logger, nil)
+func Recover(logger *Logger, opts *RecoverOptions) {
+	if r := recover(); r != nil {
+		logPanic(logger, r, opts, 2)
+	}
+}
+
+// LogPanic handles a panic value `r` already recovered by the caller, the same
+// way `Recover` does.
+func LogPanic(logger *Logger, r interface{}, opts *RecoverOptions) {
+	logPanic(logger, r, opts, 2)
+}
+
+// Go runs `fn` in a new goroutine, a panic in `fn` is logged by `logger`
+// instead of crashing the process.
+func Go(logger *Logger, fn func()) {
+	GoWithOptions(logger, nil, fn)
+}
+
+// GoWithOptions runs `fn` in a new goroutine, a panic in `fn` is handled
+// according to `opts`.
+func GoWithOptions(logger *Logger, opts *RecoverOptions, fn func()) {
+	go func() {
+		defer Recover(logger, opts)
+		fn()
+	}()
+}
+
+func logPanic(logger *Logger, r interface{}, opts *RecoverOptions, skip int) {
+	if logger == nil {
+		logger = GLogger()
+	}
+	if opts == nil {
+		opts = new(RecoverOptions)
+	}
+
+	msg := opts.Message
+	if msg == "" {
+		msg = defaultPanicMessage
+	}
+	fields := make([]Field, 0, len(opts.Fields)+3)
+	fields = append(fields,
+		Any("panic", r),
+		Int64("goroutine", traceback.GoroutineID()),
+		String("stack", traceback.TakeStacktrace(skip)))
+	fields = append(fields, opts.Fields...)
+
+	// the stack is already a field, don't let zap take another one
+	base := logger.baseLogger.WithOptions(zap.AddStacktrace(FatalLevel + 1))
+	if ce := base.Check(ErrorLevel, msg); ce != nil {
+		ce.Write(fields...)
+	}
+	_ = logger.Sync()
+
+	if opts.OnPanic != nil {
+		opts.OnPanic(r)
+	}
+	if opts.RePanic {
+		panic(r)
+	}
+	if opts.Exit {
+		code := opts.ExitCode
+		if code == 0 {
+			code = 1
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+		if err := Shutdown(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		cancel()
+		_exit(code)
+	}
+}
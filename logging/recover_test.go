@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGoRecover(t *testing.T) {
+	out := new(syncBuffer)
+	logger := newTestLogger(t, EncodeJson, DebugLevel, out)
+
+	done := make(chan interface{})
+	GoWithOptions(logger, &RecoverOptions{
+		Fields:  []Field{String("job", "compaction")},
+		OnPanic: func(r interface{}) { done <- r },
+	}, func() {
+		panic("boom")
+	})
+	if r := <-done; r != "boom" {
+		t.Fatalf("unexpected panic value %v", r)
+	}
+
+	entry := out.String()
+	for _, want := range []string{
+		`"message":"panic recovered"`, `"panic":"boom"`, `"goroutine":`,
+		`"job":"compaction"`, "recover_test.go",
+	} {
+		if !strings.Contains(entry, want) {
+			t.Errorf("%s not found in %s", want, entry)
+		}
+	}
+	if strings.Contains(entry, `"stacktrace"`) {
+		t.Errorf("unexpected zap stacktrace in %s", entry)
+	}
+}
+
+func TestRecoverRePanicAndExit(t *testing.T) {
+	logger := newTestLogger(t, EncodeConsole, DebugLevel, new(syncBuffer))
+
+	func() {
+		defer func() {
+			if r := recover(); r != "again" {
+				t.Errorf("expected re-panic, got %v", r)
+			}
+		}()
+		defer Recover(logger, &RecoverOptions{RePanic: true})
+		panic("again")
+	}()
+
+	resetShutdown(t)
+	defer resetShutdown(t)
+	shutdown := false
+	AddExitHook(func(context.Context) error {
+		shutdown = true
+		return nil
+	})
+
+	code := 0
+	_exit = func(c int) {
+		if !shutdown {
+			t.Error("exit before shutdown")
+		}
+		code = c
+	}
+	defer func() { _exit = os.Exit }()
+
+	func() {
+		defer Recover(logger, &RecoverOptions{Exit: true})
+		panic("exit")
+	}()
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+}
@@ -0,0 +1,248 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// shutdown ...
+//
+// `Shutdown` syncs and closes every registered logger, see `Register`, then
+// runs the exit hooks. It is called on SIGTERM/SIGINT once `HandleSignals` is
+// enabled, and by every `Fatal` entry before zap exits the process, so that
+// the lines buffered by the other loggers are not lost.
+
+// DefaultShutdownTimeout bounds the shutdown run by `Fatal` entries, and by
+// `HandleSignals` when its timeout is 0.
+var DefaultShutdownTimeout = 5 * time.Second
+
+var _shutdown struct {
+	sync.Mutex
+	hooks   []func(ctx context.Context) error
+	started bool
+	done    chan struct{}
+	err     error
+}
+
+// AddExitHook registers `hook` to run at the end of `Shutdown`, after the
+// loggers are closed. Hooks run in the reverse order of their registration,
+// like deferred calls.
+func AddExitHook(hook func(ctx context.Context) error) {
+	_shutdown.Lock()
+	defer _shutdown.Unlock()
+	_shutdown.hooks = append(_shutdown.hooks, hook)
+}
+
+// ShutdownError holds the errors of `Shutdown`.
+type ShutdownError []error
+
+func (e ShutdownError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return "logging shutdown: " + strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the errors matches `target`, e.g. `context.DeadlineExceeded`.
+func (e ShutdownError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Shutdown syncs and closes every registered logger, and then runs the exit hooks, the
+// loggers that are not closed when `ctx` is done are given up. Only the first
+// call shuts down, the others wait for it and return the same error.
+//
+// The loggers remain usable afterwards, their files are opened again by the
+// next entry, but nothing syncs them anymore.
+func Shutdown(ctx context.Context) error {
+	_shutdown.Lock()
+	if _shutdown.started {
+		done := _shutdown.done
+		_shutdown.Unlock()
+		select {
+		case <-done:
+			return _shutdown.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	_shutdown.started = true
+	_shutdown.done = make(chan struct{})
+	hooks := append([]func(context.Context) error(nil), _shutdown.hooks...)
+	_shutdown.Unlock()
+
+	var errs ShutdownError
+	if err := closeLoggers(ctx, registeredLoggers()); err != nil {
+		errs = append(errs, err...)
+	}
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		_shutdown.err = errs
+	}
+	close(_shutdown.done)
+	return _shutdown.err
+}
+
+func closeLoggers(ctx context.Context, loggers []*Logger) ShutdownError {
+	var (
+		mu   sync.Mutex
+		errs ShutdownError
+		wg   sync.WaitGroup
+		done = make(chan struct{})
+	)
+	for _, l := range loggers {
+		wg.Add(1)
+		go func(l *Logger) {
+			defer wg.Done()
+			if err := l.Close(); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("logger `%s`: %w", l.name_, err))
+				mu.Unlock()
+			}
+		}(l)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		mu.Lock()
+		errs = append(errs, fmt.Errorf("closing loggers: %w", ctx.Err()))
+		mu.Unlock()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return append(ShutdownError(nil), errs...)
+}
+
+// Close syncs the handlers of `l` and closes its log files. Sync errors of
+// the console handlers are ignored, stdout is often a terminal or a pipe that
+// cannot be synced. `l` leaves the registry of `Stats` and `Shutdown`.
+func (l *Logger) Close() error {
+	unregisterLogger(l)
+
+	var errs ShutdownError
+	for _, h := range l.handlers {
+		if err := h.Sync.Sync(); err != nil && h.closer != nil {
+			errs = append(errs, fmt.Errorf("sync `%s`: %w", h.Name, err))
+		}
+		if h.closer != nil {
+			if err := h.closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close `%s`: %w", h.Name, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// HandleSignals runs `Shutdown` with `timeout` when the process receives
+// SIGTERM or SIGINT, or `signals` if any, and then exits with the status
+// 128+signal like a shell does. A `timeout` of 0 means `DefaultShutdownTimeout`.
+// `stop` stops handling the signals.
+func HandleSignals(timeout time.Duration, signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, syscall.SIGINT}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+
+	quit := make(chan struct{})
+	go waitSignal(ch, quit, timeout)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(quit)
+		})
+	}
+}
+
+func waitSignal(ch <-chan os.Signal, quit <-chan struct{}, timeout time.Duration) {
+	select {
+	case sig := <-ch:
+		if timeout <= 0 {
+			timeout = DefaultShutdownTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		if err := Shutdown(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		cancel()
+
+		code := 1
+		if s, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(s)
+		}
+		_exit(code)
+	case <-quit:
+	}
+}
+
+// shutdownCore runs `Shutdown` when a FATAL entry is written. It is teed
+// after the handler cores, so the entry itself is written before, and zap
+// exits the process after it.
+type shutdownCore struct{}
+
+func (shutdownCore) Enabled(level zapcore.Level) bool {
+	return level >= FatalLevel
+}
+
+func (c shutdownCore) With([]zapcore.Field) zapcore.Core {
+	return c
+}
+
+func (c shutdownCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (shutdownCore) Write(zapcore.Entry, []zapcore.Field) error {
+	_shutdown.Lock()
+	started := _shutdown.started
+	_shutdown.Unlock()
+	if started {
+		// e.g. a hook logging at FATAL level, waiting for the shutdown would deadlock
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+	defer cancel()
+	if err := Shutdown(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+	return nil
+}
+
+func (shutdownCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// resetShutdown allows another `Shutdown` in the same test binary.
+func resetShutdown(t *testing.T) {
+	_shutdown.Lock()
+	defer _shutdown.Unlock()
+	_shutdown.hooks, _shutdown.started, _shutdown.done, _shutdown.err = nil, false, nil, nil
+}
+
+func TestShutdown(t *testing.T) {
+	resetShutdown(t)
+	defer resetShutdown(t)
+
+	file := filepath.Join(t.TempDir(), "shutdown.log")
+	logger, err := NewFileRotatingLogger("shutdown", file, DebugLevel, ErrorLevel, DebugLevel, 1, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Register(logger)
+	logger.Info("before shutdown")
+
+	var order []string
+	AddExitHook(func(context.Context) error { order = append(order, "first"); return nil })
+	AddExitHook(func(context.Context) error { order = append(order, "second"); return errors.New("hook failed") })
+
+	err = Shutdown(context.Background())
+	var errs ShutdownError
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Error() != "hook failed" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if strings.Join(order, ",") != "second,first" {
+		t.Errorf("hooks not run in reverse order: %v", order)
+	}
+	if b, _ := ioutil.ReadFile(file); !strings.Contains(string(b), "before shutdown") {
+		t.Errorf("entry not flushed: %q", b)
+	}
+
+	// only the first call shuts down
+	if err2 := Shutdown(context.Background()); err2 == nil || err2.Error() != err.Error() || len(order) != 2 {
+		t.Errorf("second shutdown: %v, hooks %v", err2, order)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	resetShutdown(t)
+	defer resetShutdown(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var hookCtx context.Context
+	AddExitHook(func(ctx context.Context) error { hookCtx = ctx; return nil })
+
+	// the loggers may all be closed before the done context is noticed
+	if err := Shutdown(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if hookCtx != ctx {
+		t.Error("exit hook not run with the shutdown context")
+	}
+}
+
+func TestFatalShutdown(t *testing.T) {
+	resetShutdown(t)
+	defer resetShutdown(t)
+
+	var shutdown bool
+	AddExitHook(func(context.Context) error { shutdown = true; return nil })
+
+	out := new(syncBuffer)
+	logger := newTestLogger(t, EncodeConsole, DebugLevel, out)
+	// panic instead of exiting the test binary
+	logger.baseLogger = logger.baseLogger.WithOptions(zap.OnFatal(zapcore.WriteThenPanic))
+	func() {
+		defer func() { _ = recover() }()
+		logger.FatalT("fatal")
+	}()
+
+	if !shutdown {
+		t.Error("Fatal did not shut down")
+	}
+	if !strings.Contains(out.String(), "fatal") {
+		t.Error("fatal entry not written before the shutdown")
+	}
+}
+
+func TestHandleSignals(t *testing.T) {
+	resetShutdown(t)
+	defer resetShutdown(t)
+	defer func() { _exit = os.Exit }()
+
+	exited := make(chan int, 1)
+	_exit = func(code int) { exited <- code }
+
+	ch := make(chan os.Signal, 1)
+	go waitSignal(ch, nil, time.Second)
+	ch <- syscall.SIGTERM
+
+	select {
+	case code := <-exited:
+		if code != 128+int(syscall.SIGTERM) {
+			t.Errorf("unexpected exit code %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no exit after the signal")
+	}
+
+	stop := HandleSignals(0)
+	stop()
+	stop()
+}
@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// stdlog ...
+//
+// Adapters for third-party code that writes to a `*log.Logger` or to an
+// `io.Writer`: every line becomes an entry of the logger, so it goes through
+// the configured handlers.
+
+// frames between `lineWriter.Write` and the caller of `log.Printf`, namely
+// `(*log.Logger).output` and `log.Printf` (or `(*log.Logger).Printf`)
+const stdLogCallerSkip = 2
+
+// lineWriter is an `io.Writer` that logs each line written to it at `level`.
+// An incomplete line is buffered until its newline arrives or `Sync` is called.
+type lineWriter struct {
+	mu     sync.Mutex
+	logger *zap.Logger
+	level  Level
+	buf    []byte
+}
+
+// Writer returns a `zapcore.WriteSyncer` that logs every line written to it at
+// `level`, without the trailing newline. Empty lines are dropped. The caller
+// reported is the code that calls `Write`, call `Sync` to log an incomplete
+// last line.
+func (l *Logger) Writer(level Level) zapcore.WriteSyncer {
+	return &lineWriter{logger: l.baseLogger, level: level}
+}
+
+// NewStdLog returns a `*log.Logger` that logs every line at `level` to
+// `logger`, with the caller of `Printf` and friends.
+func NewStdLog(logger *Logger, level Level) *log.Logger {
+	return log.New(logger.stdLogWriter(level), "", 0)
+}
+
+// RedirectStdLog sends the output of the global `log` package to `logger` at
+// INFO level, and returns a function that restores the previous output,
+// prefix and flags.
+func RedirectStdLog(logger *Logger) (restore func()) {
+	flags, prefix, out := log.Flags(), log.Prefix(), log.Writer()
+	log.SetFlags(0)
+	log.SetPrefix("")
+	log.SetOutput(logger.stdLogWriter(InfoLevel))
+	return func() {
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+		log.SetOutput(out)
+	}
+}
+
+func (l *Logger) stdLogWriter(level Level) *lineWriter {
+	return &lineWriter{logger: l.baseLogger.WithOptions(zap.AddCallerSkip(stdLogCallerSkip)), level: level}
+}
+
+// Write logs the complete lines of `p`. It checks the entries itself, not
+// through a helper, so that `baseLogger` reports the caller of `Write`.
+func (w *lineWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n = len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.buf = append(w.buf, p...)
+			break
+		}
+		line := p[:i]
+		if len(w.buf) > 0 {
+			line = append(w.buf, line...)
+			w.buf = w.buf[:0]
+		}
+		p = p[i+1:]
+
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+		if len(line) == 0 {
+			continue
+		}
+		if ce := w.logger.Check(w.level, string(line)); ce != nil {
+			ce.Write()
+		}
+	}
+	return n, nil
+}
+
+// Sync logs the buffered incomplete line, if any.
+func (w *lineWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	line := bytes.TrimSuffix(w.buf, []byte{'\r'})
+	w.buf = w.buf[:0]
+	if len(line) > 0 {
+		if ce := w.logger.Check(w.level, string(line)); ce != nil {
+			ce.Write()
+		}
+	}
+	return nil
+}
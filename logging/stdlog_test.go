@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// here returns `file:line` of its caller, as the console encoder prints it.
+func here() string {
+	_, file, line, _ := runtime.Caller(1)
+	return fmt.Sprintf("logging/%s:%d", file[strings.LastIndex(file, "/")+1:], line+1)
+}
+
+func TestWriter(t *testing.T) {
+	out := new(syncBuffer)
+	w := newTestLogger(t, EncodeConsole, DebugLevel, out).Writer(WarnLevel)
+
+	caller := here()
+	_, _ = w.Write([]byte("first\nsecond part"))
+	_, _ = w.Write([]byte(" one\r\n\npending"))
+	if strings.Contains(out.String(), "pending") {
+		t.Fatal("incomplete line logged before Sync")
+	}
+	_ = w.Sync()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{"first", "second part one", "pending"}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, got %q", len(want), lines)
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, "\t"+want[i]) || !strings.Contains(line, "WARN") {
+			t.Errorf("line %d: expected a WARN entry %q, got %q", i, want[i], line)
+		}
+	}
+	if !strings.Contains(lines[0], caller) {
+		t.Errorf("expected caller %s in %q", caller, lines[0])
+	}
+}
+
+func TestNewStdLog(t *testing.T) {
+	out := new(syncBuffer)
+	logger := newTestLogger(t, EncodeConsole, InfoLevel, out)
+
+	std := NewStdLog(logger, ErrorLevel)
+	caller := here()
+	std.Printf("connection %d reset", 7)
+	if line := out.String(); !strings.Contains(line, "ERROR") || !strings.Contains(line, caller) ||
+		!strings.HasSuffix(line, "\tconnection 7 reset\n") {
+		t.Errorf("unexpected entry %q, expected caller %s", line, caller)
+	}
+
+	NewStdLog(logger, DebugLevel).Print("disabled")
+	if strings.Contains(out.String(), "disabled") {
+		t.Error("entry below the handler level logged")
+	}
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	out := new(syncBuffer)
+	logger := newTestLogger(t, EncodeConsole, InfoLevel, out)
+
+	flags, std := log.Flags(), log.Writer()
+	restore := RedirectStdLog(logger)
+	caller := here()
+	log.Println("from the log package")
+	restore()
+
+	if line := out.String(); !strings.Contains(line, "INFO") || !strings.Contains(line, caller) ||
+		!strings.HasSuffix(line, "\tfrom the log package\n") {
+		t.Errorf("unexpected entry %q, expected caller %s", line, caller)
+	}
+	if log.Flags() != flags || log.Writer() != std {
+		t.Error("log package not restored")
+	}
+}
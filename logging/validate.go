@@ -0,0 +1,370 @@
+package logging
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// ConfProblem is a single problem found in a logging configuration file.
+type ConfProblem struct {
+	File    string
+	Line    int // 0 if the problem is not tied to a line, e.g. a missing section
+	Section string
+	Key     string
+	Message string
+	// Warning problems, e.g. unused handlers, don't prevent `SetConf` from loading the file
+	Warning bool
+}
+
+func (p *ConfProblem) String() string {
+	var b strings.Builder
+	b.WriteString(p.File)
+	if p.Line > 0 {
+		b.WriteString(":" + strconv.Itoa(p.Line))
+	}
+	b.WriteString(": ")
+	if p.Warning {
+		b.WriteString("warning: ")
+	}
+	if p.Section != "" {
+		b.WriteString("[" + p.Section + "] ")
+	}
+	if p.Key != "" {
+		b.WriteString(p.Key + ": ")
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// ConfErrors is returned by `ValidateConf` and `SetConf`, it holds every
+// problem of the configuration file in line order.
+type ConfErrors []*ConfProblem
+
+func (e ConfErrors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, p := range e {
+		lines = append(lines, p.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// HasErrors reports whether there is a problem that is not a warning.
+func (e ConfErrors) HasErrors() bool {
+	for _, p := range e {
+		if !p.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	_loggerSectionKeys = []string{
+		SectionLoggerValLevel, SectionLoggerValStackLevel, SectionLoggerValHandler,
+	}
+	_handlerSectionKeys = []string{
+		SectionHandlerValClass, SectionHandlerValLevel, SectionHandlerValMaxAge,
+		SectionHandlerValMaxSize, SectionHandlerValMaxBackups, SectionHandlerValLogFile,
+		SectionHandlerValKeyFile, SectionHandlerValKeyEnv, SectionHandlerValKeyID,
+	}
+	_handlerClasses = []string{ClassRotateFile, ClassConsole}
+)
+
+// ValidateConf checks the logging configuration file `conf` without creating
+// any logger. It returns `ConfErrors` with every problem found: unknown
+// classes, missing or undeclared handlers, invalid levels and numbers,
+// unwritable log paths and unusable encryption keys, plus warnings for unknown
+// keys, sections that are not declared and unused handlers. The problems of
+// a handler no logger uses, e.g. a missing section, are warnings too.
+func ValidateConf(conf string) (err error) {
+	v := &confValidator{file: conf}
+	if v.lines, err = scanConfLines(conf); err != nil {
+		return err
+	}
+	if v.parser, err = NewConfParser(conf); err != nil {
+		return err
+	}
+
+	v.validate()
+	if len(v.problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(v.problems, func(i, j int) bool { return v.problems[i].Line < v.problems[j].Line })
+	return v.problems
+}
+
+// confLines maps sections and `section.key` to their line numbers.
+type confLines map[string]int
+
+func (c confLines) section(section string) int {
+	return c[strings.ToLower(section)]
+}
+
+func (c confLines) key(section, key string) int {
+	if line, ok := c[strings.ToLower(section)+"."+key]; ok {
+		return line
+	}
+	return c.section(section)
+}
+
+// keys returns the keys found in `section`
+func (c confLines) keys(section string) (keys []string) {
+	prefix := strings.ToLower(section) + "."
+	for k := range c {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, strings.TrimPrefix(k, prefix))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// scanConfLines records where sections and keys are, `gopkg.in/ini.v1` keeps no line numbers.
+func scanConfLines(conf string) (lines confLines, err error) {
+	fp, err := os.Open(conf)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	var (
+		scanner = bufio.NewScanner(fp)
+		section = "default"
+	)
+	lines = make(confLines)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "", line[0] == ';', line[0] == '#':
+		case line[0] == '[' && strings.HasSuffix(line, "]"):
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			if _, ok := lines[section]; !ok {
+				lines[section] = n
+			}
+		default:
+			if i := strings.IndexAny(line, "=:"); i > 0 {
+				lines[section+"."+strings.TrimSpace(line[:i])] = n
+			}
+		}
+	}
+	return lines, scanner.Err()
+}
+
+type confValidator struct {
+	file     string
+	lines    confLines
+	parser   *confParser
+	problems ConfErrors
+	lenient  bool // reports errors as warnings, while checking an unused handler
+}
+
+func (v *confValidator) report(line int, section, key, format string, args ...interface{}) {
+	v.problems = append(v.problems, &ConfProblem{
+		File: v.file, Line: line, Section: section, Key: key, Message: fmt.Sprintf(format, args...),
+		Warning: v.lenient,
+	})
+}
+
+func (v *confValidator) warn(line int, section, key, format string, args ...interface{}) {
+	v.report(line, section, key, format, args...)
+	v.problems[len(v.problems)-1].Warning = true
+}
+
+func (v *confValidator) has(section, key string) bool {
+	return v.parser.iniFp.Section(section).HasKey(key)
+}
+
+func (v *confValidator) validate() {
+	var (
+		loggers  = v.declared(SectionLoggers, SectionLoggersValKeys)
+		handlers = v.declared(SectionHandlers, SectionHandlersValKeys)
+		used     = make(map[string]bool)
+	)
+
+	for _, name := range loggers {
+		section := SectionLoggerPrefix + name
+		if v.lines.section(section) == 0 {
+			v.report(v.lines.key(SectionLoggers, SectionLoggersValKeys), SectionLoggers, SectionLoggersValKeys,
+				"logger `%s` has no [%s] section", name, section)
+			continue
+		}
+		v.checkLevel(section, SectionLoggerValLevel)
+		v.checkLevel(section, SectionLoggerValStackLevel)
+		v.checkUnknownKeys(section, _loggerSectionKeys)
+
+		refs := splitConfList(__getCfgKey(v.parser.iniFp, section, SectionLoggerValHandler))
+		if len(refs) == 0 {
+			v.report(v.lines.key(section, SectionLoggerValHandler), section, SectionLoggerValHandler,
+				"logger `%s` has no handlers", name)
+		}
+		for _, ref := range refs {
+			used[ref] = true
+			if !__in(ref, handlers) {
+				v.report(v.lines.key(section, SectionLoggerValHandler), section, SectionLoggerValHandler,
+					"handler `%s` is not declared in [%s]", ref, SectionHandlers)
+			}
+		}
+	}
+
+	for _, name := range handlers {
+		section := SectionHandlerPrefix + name
+		v.lenient = !used[name]
+		if v.lines.section(section) == 0 {
+			v.report(v.lines.key(SectionHandlers, SectionHandlersValKeys), SectionHandlers, SectionHandlersValKeys,
+				"handler `%s` has no [%s] section", name, section)
+			continue
+		}
+		if !used[name] {
+			v.warn(v.lines.section(section), section, "", "handler `%s` is not used by any logger", name)
+		}
+		v.checkHandler(section)
+	}
+	v.lenient = false
+
+	v.checkUndeclaredSections(SectionLoggerPrefix, loggers, SectionLoggers)
+	v.checkUndeclaredSections(SectionHandlerPrefix, handlers, SectionHandlers)
+}
+
+// declared returns the names listed by `section.key`, duplicates are reported.
+func (v *confValidator) declared(section, key string) (names []string) {
+	if v.lines.section(section) == 0 {
+		v.report(0, section, "", "missing section")
+		return nil
+	}
+	line := v.lines.key(section, key)
+	for _, name := range splitConfList(__getCfgKey(v.parser.iniFp, section, key)) {
+		if __in(name, names) {
+			v.report(line, section, key, "`%s` is declared twice", name)
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		v.report(line, section, key, "nothing declared")
+	}
+	return names
+}
+
+func (v *confValidator) checkHandler(section string) {
+	v.checkLevel(section, SectionHandlerValLevel)
+	v.checkUnknownKeys(section, _handlerSectionKeys)
+
+	class := __getCfgKey(v.parser.iniFp, section, SectionHandlerValClass)
+	switch class {
+	case ClassConsole:
+	case ClassRotateFile:
+		for _, key := range []string{SectionHandlerValMaxAge, SectionHandlerValMaxSize, SectionHandlerValMaxBackups} {
+			if val := __getCfgKey(v.parser.iniFp, section, key); val != "" {
+				if n, err := strconv.Atoi(val); err != nil || n < 0 {
+					v.report(v.lines.key(section, key), section, key, "`%s` is not a non-negative integer", val)
+				}
+			}
+		}
+
+		logFile := __getCfgKey(v.parser.iniFp, section, SectionHandlerValLogFile)
+		if logFile == "" {
+			v.report(v.lines.key(section, SectionHandlerValLogFile), section, SectionHandlerValLogFile,
+				"missing log file")
+		} else if err := checkWritableDir(filepath.Dir(logFile)); err != nil {
+			v.report(v.lines.key(section, SectionHandlerValLogFile), section, SectionHandlerValLogFile,
+				"log file `%s` is not writable: %v", logFile, err)
+		}
+
+		keyFile := __getCfgKey(v.parser.iniFp, section, SectionHandlerValKeyFile)
+		keyEnv := __getCfgKey(v.parser.iniFp, section, SectionHandlerValKeyEnv)
+		if keyFile != "" || keyEnv != "" {
+			if _, err := LoadEncryptionKey(keyFile, keyEnv); err != nil {
+				key := SectionHandlerValKeyFile
+				if keyFile == "" {
+					key = SectionHandlerValKeyEnv
+				}
+				v.report(v.lines.key(section, key), section, key, "unusable encryption key: %v", err)
+			}
+		}
+	case "":
+		v.report(v.lines.section(section), section, SectionHandlerValClass, "missing handler class")
+	default:
+		v.report(v.lines.key(section, SectionHandlerValClass), section, SectionHandlerValClass,
+			"unknown handler class `%s`, valid classes are `%s`", class, strings.Join(_handlerClasses, "`, `"))
+	}
+}
+
+func (v *confValidator) checkLevel(section, key string) {
+	if !v.has(section, key) {
+		return
+	}
+	val := __getCfgKey(v.parser.iniFp, section, key)
+	if _, err := parseLevel(val); err != nil {
+		v.report(v.lines.key(section, key), section, key, "invalid level `%s`", val)
+	}
+}
+
+func (v *confValidator) checkUnknownKeys(section string, known []string) {
+	for _, key := range v.lines.keys(section) {
+		if !__in(key, known) {
+			v.warn(v.lines.key(section, key), section, key, "unknown key")
+		}
+	}
+}
+
+func (v *confValidator) checkUndeclaredSections(prefix string, declared []string, declaredIn string) {
+	for _, s := range v.parser.iniFp.SectionStrings() {
+		if name := strings.TrimPrefix(s, prefix); name != s && !__in(name, declared) {
+			v.warn(v.lines.section(s), s, "", "`%s` is not declared in [%s]", name, declaredIn)
+		}
+	}
+}
+
+func splitConfList(val string) (names []string) {
+	for _, name := range strings.Split(val, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func parseLevel(levelStr string) (level Level, err error) {
+	var l zapcore.Level
+	if err = l.UnmarshalText([]byte(levelStr)); err != nil {
+		return level, err
+	}
+	return l, nil
+}
+
+// checkWritableDir checks that log files can be created in `dir`, or in its
+// nearest existing ancestor if `dir` is created later by `MkdirAllUtilSuccess`.
+func checkWritableDir(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("`%s` is not a directory", dir)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+
+	fp, err := ioutil.TempFile(dir, ".logcheck-")
+	if err != nil {
+		return err
+	}
+	_ = fp.Close()
+	return os.Remove(fp.Name())
+}
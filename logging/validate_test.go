@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const _invalidConf = `[loggers]
+keys = root,log1,log1
+
+[handlers]
+keys = file_handler,console_handler,unused_handler,ghost_handler
+
+[logger_root]
+level = verbose
+stack_level = error
+handler = file_handler,missing_handler
+
+[logger_log1]
+level = debug
+stack_level = eror
+handler = console_handler
+colour = true
+
+[handler_file_handler]
+class = logging.NewFileRotatingLogger
+log_file = %s
+max_size = 30MB
+level = info
+
+[handler_console_handler]
+class = logging.NewConsoleStreamingLogger
+level = warn
+
+[handler_unused_handler]
+class = logging.NewSyslogLogger
+level = info
+
+[logger_orphan]
+level = info
+`
+
+func TestValidateConf(t *testing.T) {
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "blocker")
+	if err := ioutil.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(dir, "log.ini")
+	content := strings.Replace(_invalidConf, "%s", filepath.Join(blocker, "app.log"), 1)
+	if err := ioutil.WriteFile(conf, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := ValidateConf(conf)
+	var problems ConfErrors
+	if !errors.As(err, &problems) {
+		t.Fatalf("expected ConfErrors, got %v", err)
+	}
+
+	want := []struct {
+		line    int
+		section string
+		key     string
+		message string
+		warning bool
+	}{
+		{2, "loggers", "keys", "`log1` is declared twice", false},
+		{5, "handlers", "keys", "handler `ghost_handler` has no [handler_ghost_handler] section", true},
+		{8, "logger_root", "level", "invalid level `verbose`", false},
+		{10, "logger_root", "handler", "handler `missing_handler` is not declared in [handlers]", false},
+		{14, "logger_log1", "stack_level", "invalid level `eror`", false},
+		{16, "logger_log1", "colour", "unknown key", true},
+		{20, "handler_file_handler", "log_file", "is not writable", false},
+		{21, "handler_file_handler", "max_size", "`30MB` is not a non-negative integer", false},
+		{28, "handler_unused_handler", "", "handler `unused_handler` is not used by any logger", true},
+		{29, "handler_unused_handler", "class", "unknown handler class `logging.NewSyslogLogger`", true},
+		{32, "logger_orphan", "", "`orphan` is not declared in [loggers]", true},
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("expected %d problems, got %d:\n%v", len(want), len(problems), problems)
+	}
+	for i, w := range want {
+		p := problems[i]
+		if p.Line != w.line || p.Section != w.section || p.Key != w.key || p.Warning != w.warning ||
+			!strings.Contains(p.Message, w.message) {
+			t.Errorf("problem %d: expected %d [%s] %s: %s, got %s", i, w.line, w.section, w.key, w.message, p)
+		}
+	}
+}
+
+// exampleConf writes the example configuration to a temporary directory.
+func exampleConf(t *testing.T) string {
+	dir := t.TempDir()
+	content, err := ioutil.ReadFile("../_examples/logging/log.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the example only runs on the author's machine
+	conf := strings.Replace(string(content), `D:\workspace\gopkg\_examples\logging\`, dir+string(filepath.Separator), -1)
+	confFile := filepath.Join(dir, "log.ini")
+	if err = ioutil.WriteFile(confFile, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return confFile
+}
+
+func TestValidateConfExample(t *testing.T) {
+	// `log2_handler` is declared without section, it is not used and only warned about
+	err := ValidateConf(exampleConf(t))
+	var problems ConfErrors
+	if !errors.As(err, &problems) || problems.HasErrors() || len(problems) != 1 {
+		t.Errorf("unexpected problems:\n%v", err)
+	}
+}
+
+func TestSetConfWarnings(t *testing.T) {
+	// `SetConf` loads the global pool once
+	lc := _lc
+	_lc = NewLoggerContainer()
+	defer func() { _lc = lc }()
+
+	lp, err := SetConf(exampleConf(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = lp.GetLogger("log1"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,29 @@
+package traceback
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+)
+
+var _goroutinePrefix = []byte("goroutine ")
+
+// GoroutineID returns the id of the calling goroutine, parsed from the header
+// of its stack trace (`goroutine 18 [running]:`). It returns 0 if the header
+// can not be parsed. It is meant for logs only, never key data by it.
+func GoroutineID() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	if !bytes.HasPrefix(b, _goroutinePrefix) {
+		return 0
+	}
+	b = b[len(_goroutinePrefix):]
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}